@@ -4,12 +4,22 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+
+	"minesweeper/server"
 )
 
 func main() {
-	// staticフォルダの中身（html, js, wasm）をそのまま配信するだけ
+	// staticフォルダの中身（html, js, wasm）をそのまま配信する
 	http.Handle("/", http.FileServer(http.Dir("static")))
 
-	fmt.Println("File Server starting on :8080...")
+	// wasm を使わないクライアント用の API (盤面はサーバー側で1つだけ持つ)
+	// /api/open?x=&y=&diff=1 は変化したマスだけを返します
+	// /api/hint?level=1..3 は盤面を変えずにヒントを返します
+	srv := server.NewServer()
+	http.HandleFunc("/api/new", srv.HandleNew)
+	http.HandleFunc("/api/open", srv.HandleOpen)
+	http.HandleFunc("/api/hint", srv.HandleHint)
+
+	fmt.Println("Server starting on :8080...")
 	log.Fatal(http.ListenAndServe("0.0.0.0:8080", nil))
 }
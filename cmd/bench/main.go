@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"minesweeper/game"
+	"minesweeper/solver"
+)
+
+// ネイティブ環境でソルバーの強さと速さを測るためのベンチマーク
+// デフォルトは上級 (30x16, 99個)
+func main() {
+	width := flag.Int("w", 30, "board width")
+	height := flag.Int("h", 16, "board height")
+	mines := flag.Int("m", 99, "mine count")
+	games := flag.Int("games", 200, "number of games")
+	mode := flag.String("mode", "hybrid", "pipeline preset, comma-separated strategies, or \"all\" for every preset")
+	list := flag.Bool("list", false, "list pipeline presets and strategies, then exit")
+	samples := flag.Int("samples", 0, "Monte Carlo samples per estimate (0 = default)")
+	crosscheck := flag.Bool("crosscheck", false, "compare tank and SAT deductions at every position")
+	parallel := flag.Int("parallel", runtime.GOMAXPROCS(0), "number of games played concurrently")
+	timeout := flag.Duration("timeout", 0, "time limit per solver step (0 = none)")
+	seed := flag.Int64("seed", 0, "base seed; game i uses seed+i (0 = random)")
+	flag.Parse()
+
+	if *list {
+		fmt.Println("Presets:")
+		for _, p := range solver.Presets {
+			fmt.Printf("  %-10s %s\n", p.Name, p.Config)
+		}
+		fmt.Println("Strategies:", solver.StrategyNames())
+		return
+	}
+
+	if err := game.NewBoard(*width, *height, *mines).CheckMineCount(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *parallel < 1 {
+		*parallel = 1
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	configs := []string{*mode}
+	if *mode == "all" {
+		configs = configs[:0]
+		for _, p := range solver.Presets {
+			configs = append(configs, p.Name)
+		}
+	}
+
+	for i, config := range configs {
+		if _, err := solver.ParsePipeline(config); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		run(config, *width, *height, *mines, *games, *samples, *crosscheck, *parallel, *seed, *timeout)
+	}
+}
+
+// run は1つのパイプラインで games 回プレイし、結果を表示します
+// ゲーム i の盤面と推測の乱数は seed+i から作るので、並列数によらず同じ盤面・同じ乱数でプレイします
+// ただしタンク (DefaultTankBudget)、モンテカルロ、終盤探索には時間の上限があるので、
+// 上限に達する局面では並列数やマシンの負荷によって手が変わり、結果がずれることがあります
+func run(config string, width, height, mines, games, samples int, crosscheck bool, parallel int, seed int64, timeout time.Duration) {
+	results := make([]gameStats, games)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	start := time.Now()
+
+	for w := 0; w < parallel; w++ {
+		bot, err := solver.NewFromConfig(nil, config)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bot.SampleBudget = samples
+			if parallel > 1 {
+				bot.Workers = 1 // ゲーム単位で並列にするので、セグメントは順に数える
+			}
+			for i := range jobs {
+				results[i] = play(bot, width, height, mines, seed+int64(i), crosscheck, timeout)
+			}
+		}()
+	}
+	for i := 0; i < games; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	duration := time.Since(start)
+
+	var total gameStats
+	for _, r := range results {
+		total.merge(r)
+	}
+
+	fmt.Printf("Board: %dx%d, %d mines, pipeline %s, seed %d\n", width, height, mines, config, seed)
+	fmt.Printf("Games: %d, Wins: %d (%.1f%%)\n", games, total.Wins, float64(total.Wins)/float64(games)*100)
+	fmt.Printf("Time: %v (%.1f ms/game, %d parallel, slowest step %v)\n",
+		duration, float64(duration.Milliseconds())/float64(games), parallel, total.Slowest)
+	if total.Wins > 0 {
+		fmt.Printf("Clicks: %.1f per win, 3BV %.1f, efficiency %.1f%%\n",
+			float64(total.Clicks)/float64(total.Wins), float64(total.BBBV)/float64(total.Wins),
+			float64(total.BBBV)/float64(total.Clicks)*100)
+	}
+	if timeout > 0 {
+		fmt.Printf("Timeout: %v per step, %d approximate moves\n", timeout, total.Approximate)
+	}
+
+	if crosscheck {
+		fmt.Printf("Cross-check: %d positions, %d mismatches, %d wrong certain moves\n",
+			total.check.positions, total.check.mismatches, total.check.wrong)
+	}
+	fmt.Println(total.Table())
+}
+
+// gameStats は1ゲーム (または合計) の集計
+type gameStats struct {
+	solver.Stats
+	check checkStats
+}
+
+func (g *gameStats) merge(o gameStats) {
+	g.Merge(&o.Stats)
+	g.check.positions += o.check.positions
+	g.check.mismatches += o.check.mismatches
+	g.check.wrong += o.check.wrong
+}
+
+// play は seed から作った盤面で1ゲームをプレイします
+// timeout が正なら1手ごとに時間の上限を付けます
+func play(bot *solver.Solver, width, height, mines int, seed int64, crosscheck bool, timeout time.Duration) gameStats {
+	var stats gameStats
+	b := game.NewBoard(width, height, mines)
+	b.Rand = rand.New(rand.NewSource(seed))
+	bot.SetBoard(b)
+	bot.Rand = rand.New(rand.NewSource(seed))
+
+	for alive := true; alive && !b.IsFinished(); {
+		if crosscheck {
+			stats.check.add(b)
+		}
+		// 確定手はまとめて適用し、無ければ1手推測する
+		t := time.Now()
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		batch := bot.StepContext(ctx)
+		cancel()
+		d := time.Since(t)
+		if len(batch) == 0 {
+			break
+		}
+		stats.Step(d)
+
+		for _, move := range batch {
+			if alive = stats.Apply(b, move, d/time.Duration(len(batch))); !alive {
+				break
+			}
+		}
+	}
+	stats.EndGame(b)
+	return stats
+}
+
+// checkStats はタンクと SAT の確定判定の突き合わせ結果
+type checkStats struct {
+	positions  int
+	mismatches int // 片方だけが確定手を見つけた局面
+	wrong      int // 実際の盤面と合わない確定手
+}
+
+// add は局面を両方の方式で解き、確定手の有無と正しさを比べます
+// タンクが厳密に数えきれなかった局面 (nil) は比較しません
+func (c *checkStats) add(b *game.Board) {
+	if !b.IsInitialized {
+		return
+	}
+	tank := solver.NewTankSolver(b).Solve()
+	sat := solver.NewSATSolver(b).Solve()
+	c.positions++
+
+	certain := func(m *solver.Move) bool {
+		if m == nil || m.Confidence != 1.0 {
+			return false
+		}
+		if b.Cells[m.Y][m.X].IsMine != (m.Type == solver.MoveFlag) {
+			c.wrong++
+		}
+		return true
+	}
+	tankCertain, satCertain := certain(tank), certain(sat)
+	if tank != nil && tankCertain != satCertain {
+		c.mismatches++
+	}
+}
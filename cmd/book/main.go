@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"minesweeper/game"
+	"minesweeper/solver"
+)
+
+// 盤面設定ごとに最初のクリックの良さをシミュレーションで測り、オープニングブックに書き込むツール
+// 盤面は上下左右 (正方形なら対角も) 対称なので、左上の 1/4 (1/8) のマスだけを試します
+// 全ての候補と既定の初手 (ブックを使わないパイプラインが選ぶマス) で同じ種 (seed+i) を使い、
+// ゲームごとの勝敗の差で比べます (対応のある比較)
+// 同じ盤面になるのは -first any だけです。opening と safe では地雷はクリックしたマスを避けて置かれるので、
+// 同じ種でも候補ごとに配置が変わり、そろうのは乱数の列とソルバーの推測だけです
+// その場合も差の区間は正しく求まりますが、盤面の運のばらつきはほとんど打ち消されません
+// 最も良かった候補は、別の種 (seed+games+i) のゲームで既定の初手と比べ直します
+// たくさんの候補から一番を選ぶと、選んだゲームでの勝率は高めに出るためです
+// 比べ直した勝率の差の 95% 区間が 0 より上にある場合だけ、ブックが初手を決めます
+func main() {
+	width := flag.Int("w", 30, "board width")
+	height := flag.Int("h", 16, "board height")
+	mines := flag.Int("m", 99, "mine count")
+	first := flag.String("first", "opening", "first click rule (opening, safe, any)")
+	games := flag.Int("games", 200, "games per candidate cell, and held-out games for the winner")
+	config := flag.String("mode", "logic,advanced,linear,tank,montecarlo,ai", "pipeline that plays the rest of each game")
+	parallel := flag.Int("parallel", runtime.GOMAXPROCS(0), "number of games played concurrently")
+	seed := flag.Int64("seed", 1, "base seed; game i of every candidate uses seed+i")
+	out := flag.String("out", "solver/openings.json", "opening book to update (empty = print only)")
+	flag.Parse()
+
+	rule, err := game.ParseFirstClick(*first)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	check := game.NewBoard(*width, *height, *mines)
+	check.Rules.FirstClick = rule
+	if err := check.CheckMineCount(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	pipeline, err := solver.ParsePipeline(*config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// 既定の初手はブックを使わずに選ばせる
+	var rest solver.Pipeline
+	for _, st := range pipeline {
+		if st.Name() != "opening" {
+			rest = append(rest, st)
+		}
+	}
+	if *parallel < 1 {
+		*parallel = 1
+	}
+	if *games < 2 {
+		*games = 2
+	}
+	sim := simulation{width: *width, height: *height, mines: *mines, rule: rule, pipeline: rest, parallel: *parallel}
+
+	base := &candidate{x: -1, y: -1}
+	cands := []*candidate{base}
+	for y := 0; y <= (*height-1)/2; y++ {
+		for x := 0; x <= (*width-1)/2; x++ {
+			if *width == *height && x > y {
+				continue
+			}
+			cands = append(cands, &candidate{x: x, y: y})
+		}
+	}
+	start := time.Now()
+	sim.run(cands, *games, *seed)
+	cands = cands[1:]
+	// 勝率の高い順、同じなら最初に開くマスの多い順
+	sort.SliceStable(cands, func(i, j int) bool {
+		if cands[i].wins != cands[j].wins {
+			return cands[i].wins > cands[j].wins
+		}
+		return cands[i].total > cands[j].total
+	})
+
+	fmt.Printf("Board: %dx%d, %d mines, first click %s, %d games per cell, %d cells (%v)\n",
+		*width, *height, *mines, rule, *games, len(cands), time.Since(start).Round(time.Millisecond))
+	fmt.Printf("Default first click: %.1f%% wins\n", base.rate())
+	fmt.Println("Cell      Win rate   vs default   Avg opening")
+	for _, c := range cands[:min(10, len(cands))] {
+		fmt.Printf("(%2d,%2d) %8.1f%% %+11.1f%% %13.1f\n", c.x, c.y,
+			c.rate(), c.rate()-base.rate(), float64(c.total)/float64(*games))
+	}
+
+	// 選んだマスを別の種のゲームで既定の初手と比べ直す
+	best := &candidate{x: cands[0].x, y: cands[0].y}
+	base = &candidate{x: -1, y: -1}
+	sim.run([]*candidate{base, best}, *games, *seed+int64(*games))
+	gain, gainLow, gainHigh := pairedGain(best.won, base.won)
+	winLow, winHigh := wilson(best.wins, *games)
+	entry := solver.Opening{
+		Width: *width, Height: *height, Mines: *mines, FirstClick: rule.String(),
+		X: best.x, Y: best.y,
+		WinRate: float64(best.wins) / float64(*games),
+		WinLow:  winLow, WinHigh: winHigh,
+		DefaultWinRate: float64(base.wins) / float64(*games),
+		GainLow:        gainLow,
+		Games:          *games,
+	}
+	fmt.Printf("Held-out %d games: (%d,%d) %.1f%% wins (95%% interval %.1f-%.1f%%), default %.1f%%, gain %+.1f%% (%+.1f to %+.1f%%)\n",
+		*games, best.x, best.y, best.rate(), winLow*100, winHigh*100, base.rate(), gain*100, gainLow*100, gainHigh*100)
+	if !entry.Better() {
+		fmt.Println("Not significantly better than the default first click; the book will leave the first click to the pipeline")
+	}
+
+	if *out == "" {
+		return
+	}
+	if err := update(*out, entry); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Updated %s: (%d,%d)\n", *out, entry.X, entry.Y)
+}
+
+// candidate は最初にクリックするマスの候補です (x < 0 なら既定の初手)
+type candidate struct {
+	x, y   int
+	won    []bool // ゲームごとの結果
+	opened []int  // ゲームごとの、最初のクリックで開いたマスの数
+
+	wins, total int // 勝った数、開いたマスの合計
+}
+
+// rate は勝率 (%) を返します
+func (c *candidate) rate() float64 {
+	return float64(c.wins) / float64(len(c.won)) * 100
+}
+
+// simulation は1つの盤面設定でゲームを並列にプレイします
+type simulation struct {
+	width, height, mines int
+	rule                 game.FirstClickRule
+	pipeline             solver.Pipeline
+	parallel             int
+}
+
+// run は全ての候補で games 回ずつプレイします。ゲーム i はどの候補でも種 seed+i を使います
+func (sim simulation) run(cands []*candidate, games int, seed int64) {
+	for _, c := range cands {
+		c.won, c.opened = make([]bool, games), make([]int, games)
+	}
+	type job struct {
+		c *candidate
+		i int
+	}
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	for w := 0; w < sim.parallel; w++ {
+		bot := solver.NewWithPipeline(nil, sim.pipeline)
+		if sim.parallel > 1 {
+			bot.Workers = 1
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				j.c.won[j.i], j.c.opened[j.i] = sim.play(bot, j.c.x, j.c.y, seed+int64(j.i))
+			}
+		}()
+	}
+	for _, c := range cands {
+		for i := 0; i < games; i++ {
+			jobs <- job{c, i}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, c := range cands {
+		c.wins, c.total = 0, 0
+		for i, win := range c.won {
+			if win {
+				c.wins++
+			}
+			c.total += c.opened[i]
+		}
+	}
+}
+
+// play は (x, y) を最初に開けてから (x < 0 なら初手もソルバーが選ぶ)、残りをソルバーでプレイします
+// 勝ったかどうかと、最初のクリックで開いたマスの数を返します
+func (sim simulation) play(bot *solver.Solver, x, y int, seed int64) (bool, int) {
+	b := game.NewBoard(sim.width, sim.height, sim.mines)
+	b.Rules.FirstClick = sim.rule
+	b.Rand = rand.New(rand.NewSource(seed))
+	bot.SetBoard(b)
+	bot.Rand = rand.New(rand.NewSource(seed))
+
+	if x < 0 {
+		move := bot.NextMove()
+		if move == nil {
+			return false, 0
+		}
+		x, y = move.X, move.Y
+	}
+	if !b.Open(x, y) {
+		return false, 0
+	}
+	opened := 0
+	for _, row := range b.Cells {
+		for _, c := range row {
+			if c.IsRevealed {
+				opened++
+			}
+		}
+	}
+
+	for alive := true; alive && !b.IsFinished(); {
+		// 確定手はまとめて適用し、無ければ1手推測する
+		batch := bot.Step()
+		if len(batch) == 0 {
+			break
+		}
+		for _, move := range batch {
+			if alive = move.Apply(b); !alive {
+				break
+			}
+		}
+	}
+	return b.CheckClear(), opened
+}
+
+// z95 は両側 95% 区間の正規分布の分位点
+const z95 = 1.96
+
+// pairedGain は同じ種のゲームどうしの勝敗の差から、勝率の差とその 95% 区間を返します
+func pairedGain(won, base []bool) (mean, low, high float64) {
+	n := float64(len(won))
+	var sum, sq float64
+	for i := range won {
+		d := 0.0
+		if won[i] {
+			d++
+		}
+		if base[i] {
+			d--
+		}
+		sum += d
+		sq += d * d
+	}
+	mean = sum / n
+	variance := (sq - n*mean*mean) / (n - 1)
+	half := z95 * math.Sqrt(max(variance, 0)/n)
+	return mean, mean - half, mean + half
+}
+
+// wilson は n 回中 wins 回勝った勝率の 95% Wilson 区間を返します
+func wilson(wins, n int) (low, high float64) {
+	p, nf := float64(wins)/float64(n), float64(n)
+	denom := 1 + z95*z95/nf
+	center := (p + z95*z95/(2*nf)) / denom
+	half := z95 * math.Sqrt(p*(1-p)/nf+z95*z95/(4*nf*nf)) / denom
+	return max(center-half, 0), min(center+half, 1)
+}
+
+// update はブックの同じ設定の項目を置き換え (無ければ追加し)、設定順に並べて書き戻します
+func update(path string, entry solver.Opening) error {
+	var book []solver.Opening
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &book); err != nil {
+			return fmt.Errorf("read %s: %w", path, err)
+		}
+	}
+	replaced := false
+	for i, e := range book {
+		if e.Width == entry.Width && e.Height == entry.Height && e.Mines == entry.Mines && e.FirstClick == entry.FirstClick {
+			book[i], replaced = entry, true
+		}
+	}
+	if !replaced {
+		book = append(book, entry)
+	}
+	sort.Slice(book, func(i, j int) bool {
+		a, b := book[i], book[j]
+		if a.Width*a.Height != b.Width*b.Height {
+			return a.Width*a.Height < b.Width*b.Height
+		}
+		if a.Mines != b.Mines {
+			return a.Mines < b.Mines
+		}
+		return a.FirstClick < b.FirstClick
+	})
+
+	data, err := json.MarshalIndent(book, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
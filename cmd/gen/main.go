@@ -2,10 +2,12 @@ package main
 
 import (
 	"encoding/csv"
+	"flag"
 	"fmt"
 	"math/rand"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"minesweeper/game"
@@ -13,9 +15,29 @@ import (
 )
 
 func main() {
-	// 1万試合のデータを集める
-	gamesToPlay := 10000
-	filename := "dataset.csv"
+	// デフォルトは1万試合のデータを集める
+	gamesFlag := flag.Int("games", 10000, "number of games to play")
+	outFlag := flag.String("out", "dataset.csv", "output CSV file")
+	distFlag := flag.String("dist", "uniform", "comma separated mine distributions ("+strings.Join(game.DistributionNames, ", ")+", all)")
+	mapFlag := flag.String("densitymap", "", "CSV file of per-region mine densities (added to -dist)")
+	forbidFlag := flag.String("forbid", "", "forbidden zones as x,y,w,h;x,y,w,h (applied to every distribution)")
+	flag.Parse()
+
+	gamesToPlay := *gamesFlag
+	filename := *outFlag
+
+	dists, err := buildDistributions(*distFlag, *mapFlag, *forbidFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// 禁止区域などで地雷を置けない設定は、ゲームを始める前に断る
+	for _, dist := range dists {
+		if err := newBoard(dist).CheckMineCount(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
 
 	file, err := os.Create(filename)
 	if err != nil {
@@ -38,7 +60,9 @@ func main() {
 	rand.Seed(time.Now().UnixNano())
 
 	for i := 0; i < gamesToPlay; i++ {
-		playGameAndRecord(writer)
+		// 一様分布だけに偏らないよう、試合ごとに分布を選び直す
+		dist := dists[rand.Intn(len(dists))]
+		playGameAndRecord(writer, dist)
 		if i%1000 == 0 {
 			fmt.Print(".")
 		}
@@ -46,32 +70,48 @@ func main() {
 	fmt.Println("\nDone! Saved to", filename)
 }
 
-func playGameAndRecord(writer *csv.Writer) {
+// newBoard はデータを集める盤面を作ります
+func newBoard(dist game.MineDistribution) *game.Board {
 	// AI学習用には中級程度の密度が良い
-	w, h, mines := 9, 9, 10
-	b := game.NewBoard(w, h, mines)
+	b := game.NewBoard(9, 9, 10)
+	b.Distribution = dist
+	return b
+}
+
+func playGameAndRecord(writer *csv.Writer, dist game.MineDistribution) {
+	b := newBoard(dist)
 
 	// 最初の一手（ランダムオープン）
 	bot := solver.New(b, solver.ModeHybrid)
-	if first := bot.NextMove(); first != nil {
-		b.Open(first.X, first.Y)
+	first := bot.NextMove()
+	if first == nil || !b.Open(first.X, first.Y) {
+		return
 	}
 
-	for {
-		if b.CheckClear() {
-			break
-		}
+	for !b.IsFinished() {
 
-		move := bot.NextMove()
-		if move == nil {
+		// 確定手は記録しないので、1回の解析でまとめて適用する
+		batch := bot.Step()
+		if len(batch) == 0 {
 			break
 		}
+		if !batch[0].IsGuess {
+			for _, m := range batch {
+				if m.Type == solver.MoveOpen {
+					if !b.Open(m.X, m.Y) {
+						return
+					}
+				} else {
+					b.ToggleFlag(m.X, m.Y)
+				}
+			}
+			continue
+		}
+		move := &batch[0]
 
 		// ★重要: 「運任せ（Guess）」の場面だけを記録する
 		// ロジックで解ける場面を学習させても意味がないため
-		if move.IsGuess {
-			recordState(writer, b, move.X, move.Y)
-		}
+		recordState(writer, b, move.X, move.Y)
 
 		if move.Type == solver.MoveOpen {
 			if !b.Open(move.X, move.Y) {
@@ -92,7 +132,7 @@ func recordState(writer *csv.Writer, b *game.Board, tx, ty int) {
 			nx, ny := tx+dx, ty+dy
 			val := 9 // 範囲外(壁)
 
-			if nx >= 0 && nx < b.Width && ny >= 0 && ny < b.Height {
+			if b.Contains(nx, ny) {
 				cell := b.Cells[ny][nx]
 				if !cell.IsRevealed {
 					if cell.IsFlagged {
@@ -117,3 +157,96 @@ func recordState(writer *csv.Writer, b *game.Board, tx, ty int) {
 
 	writer.Write(row)
 }
+
+// buildDistributions はフラグから試合ごとに使う分布の候補を作ります
+func buildDistributions(names, mapFile, forbid string) ([]game.MineDistribution, error) {
+	var dists []game.MineDistribution
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "all" {
+			for _, n := range game.DistributionNames {
+				d, _ := game.ParseDistribution(n)
+				dists = append(dists, d)
+			}
+			continue
+		}
+		if name == "" && mapFile != "" {
+			continue
+		}
+		d, err := game.ParseDistribution(name)
+		if err != nil {
+			return nil, err
+		}
+		dists = append(dists, d)
+	}
+
+	if mapFile != "" {
+		grid, err := loadDensityMap(mapFile)
+		if err != nil {
+			return nil, err
+		}
+		dists = append(dists, game.DensityMap{Grid: grid})
+	}
+
+	if forbid != "" {
+		zones, err := parseZones(forbid)
+		if err != nil {
+			return nil, err
+		}
+		for i, d := range dists {
+			dists[i] = game.Forbidden{Base: d, Zones: zones}
+		}
+	}
+
+	if len(dists) == 0 {
+		dists = append(dists, game.Uniform{})
+	}
+	return dists, nil
+}
+
+// loadDensityMap は数値のCSVを密度マップとして読み込みます
+func loadDensityMap(filename string) ([][]float64, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	grid := make([][]float64, len(records))
+	for y, rec := range records {
+		grid[y] = make([]float64, len(rec))
+		for x, field := range rec {
+			v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", filename, y+1, err)
+			}
+			grid[y][x] = v
+		}
+	}
+	return grid, nil
+}
+
+// parseZones は "x,y,w,h;x,y,w,h" 形式の禁止区域をパースします
+func parseZones(spec string) ([]game.Rect, error) {
+	var zones []game.Rect
+	for _, part := range strings.Split(spec, ";") {
+		fields := strings.Split(part, ",")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("invalid zone %q (want x,y,w,h)", part)
+		}
+		v := make([]int, 4)
+		for i, f := range fields {
+			n, err := strconv.Atoi(strings.TrimSpace(f))
+			if err != nil {
+				return nil, fmt.Errorf("invalid zone %q: %v", part, err)
+			}
+			v[i] = n
+		}
+		zones = append(zones, game.Rect{X: v[0], Y: v[1], W: v[2], H: v[3]})
+	}
+	return zones, nil
+}
@@ -3,6 +3,8 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"syscall/js"
 	"time"
@@ -14,49 +16,175 @@ import (
 
 // GameSession はゲームの状態と統計情報を管理します
 type GameSession struct {
-	board *game.Board
-	stats struct {
-		Logic  int
-		AI     int
-		Random int
-	}
-	mode solver.SolverMode // 現在のBotモード
+	board    *game.Board
+	stats    solver.Stats   // このゲームで Bot が打った手の段階ごとの集計と、人間が使ったヒントの数
+	pipeline string         // 現在のBotのパイプライン (プリセット名またはカンマ区切りの段階名)
+	bot      *solver.Solver // ゲーム中は使い回し、タンクの数え上げ結果を再利用する
+	rules    game.Ruleset   // 次のゲームから適用するルール
+
+	patchMode bool        // true なら変化したマスだけを返す
+	sent      *game.Board // 最後にJSへ送った盤面 (差分の基準)
+}
+
+// stepTimeout は Bot の1手の解析にかける時間の上限
+// WebAssembly はメインスレッドで動くので、これを超えるとそれまでの最善の手で打ち切ります
+const stepTimeout = 1 * time.Second
+
+// nextMove はブラウザが固まらないよう、時間の上限付きで次の手を求めます
+func nextMove(bot *solver.Solver) *solver.Move {
+	ctx, cancel := context.WithTimeout(context.Background(), stepTimeout)
+	defer cancel()
+	return bot.NextMoveContext(ctx)
+}
+
+// step は時間の上限付きで、確定手を全て (無ければ推測手を1つ) 求めます
+func step(bot *solver.Solver) []solver.Move {
+	ctx, cancel := context.WithTimeout(context.Background(), stepTimeout)
+	defer cancel()
+	return bot.StepContext(ctx)
 }
 
-// デフォルトはHybridモード
-var session = &GameSession{mode: solver.ModeHybrid}
+// デフォルトは先頭のプリセット (Hybrid)
+var session = &GameSession{pipeline: solver.Presets[0].Name}
 
 // モード切替関数 (JSから呼ばれる)
+// 引数: プリセット名、または "logic,tank,ai" のようなカンマ区切りの段階名
 func setSolverModeWrapper(_ js.Value, args []js.Value) interface{} {
+	config := solver.Presets[0].Name
+	if len(args) > 0 && args[0].Type() == js.TypeString {
+		config = args[0].String()
+	}
+	p, err := solver.ParsePipeline(config)
+	if err != nil {
+		return err.Error()
+	}
+	session.pipeline = config
+	session.bot = nil
+	return fmt.Sprintf("Switched to %s (%s)", config, p)
+}
+
+// パイプライン一覧関数 (JSから呼ばれる)
+// モード選択の選択肢を作るため、プリセットを JSON で返します
+func listPipelinesWrapper(_ js.Value, _ []js.Value) interface{} {
+	type entry struct {
+		Name        string `json:"name"`
+		Config      string `json:"config"`
+		Description string `json:"description"`
+	}
+	list := make([]entry, len(solver.Presets))
+	for i, p := range solver.Presets {
+		list[i] = entry{p.Name, p.Config, p.Description}
+	}
+	out, _ := json.Marshal(list)
+	return string(out)
+}
+
+// ルール切替関数 (JSから呼ばれる)
+// 引数: 勝利条件の名前, タイムアタックの制限秒数 (省略可), 初手のルールの名前 (省略可)
+func setRulesWrapper(_ js.Value, args []js.Value) interface{} {
+	rules := game.Ruleset{}
 	if len(args) > 0 {
-		modeStr := args[0].String()
-		if modeStr == "pure" {
-			session.mode = solver.ModePureAI
-			return "Switched to Pure AI Mode"
+		win, err := game.ParseWinCondition(args[0].String())
+		if err != nil {
+			return err.Error()
+		}
+		rules.Win = win
+	}
+	if len(args) > 1 && args[1].Type() == js.TypeNumber {
+		rules.TimeLimit = time.Duration(args[1].Float() * float64(time.Second))
+	}
+	if len(args) > 2 && args[2].Type() == js.TypeString {
+		first, err := game.ParseFirstClick(args[2].String())
+		if err != nil {
+			return err.Error()
 		}
+		rules.FirstClick = first
 	}
-	session.mode = solver.ModeHybrid
-	return "Switched to Hybrid Mode"
+	session.rules = rules
+	return fmt.Sprintf("Rules: %s, first click %s (applied from next game)", rules.Win, rules.FirstClick)
 }
 
 // NewGame: ゲームと統計をリセットします
-func (s *GameSession) NewGame(width, height, mineCount int) string {
-	s.board = game.NewBoard(width, height, mineCount)
+// shape は game.ParseShape の名前 (不明な場合は長方形)
+func (s *GameSession) NewGame(width, height, mineCount int, shape string) string {
+	mask, err := game.ParseShape(shape, width, height)
+	if err != nil {
+		fmt.Println("Shape Error:", err)
+	}
+	b := game.NewMaskedBoard(width, height, mineCount, mask)
+	b.Rules = s.rules
+	// 地雷が入りきらない設定は断り、今の盤面のまま続ける
+	if err := b.CheckMineCount(); err != nil {
+		if s.board == nil {
+			return "{}"
+		}
+		return s.render("New game refused: "+err.Error(), nil)
+	}
+	s.board = b
 
 	// 統計リセット
-	s.stats.Logic = 0
-	s.stats.AI = 0
-	s.stats.Random = 0
+	s.stats = solver.Stats{}
 
-	return viewmodel.NewGameView(s.board, "")
+	s.sent = nil
+	s.bot = nil
+	return s.render("", nil)
+}
+
+// solver は現在の盤面とパイプラインのソルバーを返します (無ければ作る)
+func (s *GameSession) solver() (*solver.Solver, error) {
+	if s.bot == nil {
+		bot, err := solver.NewFromConfig(s.board, s.pipeline)
+		if err != nil {
+			return nil, err
+		}
+		s.bot = bot
+	}
+	return s.bot, nil
+}
+
+// render は盤面をJSONにします。差分モードなら前回送った盤面との差分を返します
+// move があれば、その手と理由も含めます
+func (s *GameSession) render(report string, move *solver.Move) string {
+	return s.renderView(report, viewmodel.NewMoveView(move))
+}
+
+// renderView は表示用に変換済みの手を付けて盤面を返します
+func (s *GameSession) renderView(report string, view *viewmodel.MoveView) string {
+	var out string
+	if s.patchMode {
+		out = viewmodel.NewGamePatchWithMove(s.sent, s.board, report, view)
+	} else {
+		out = viewmodel.NewGameViewWithMove(s.board, report, view)
+	}
+	s.sent = s.board.Clone()
+	return out
+}
+
+// 差分モード切替関数 (JSから呼ばれる)
+func setPatchModeWrapper(_ js.Value, args []js.Value) interface{} {
+	session.patchMode = len(args) > 0 && args[0].Truthy()
+	// 切り替え直後は全体を送り直す
+	session.sent = nil
+	return session.patchMode
 }
 
 func (s *GameSession) Open(x, y int) string {
 	if s.board == nil {
 		return "{}"
 	}
-	s.board.Open(x, y)
-	return viewmodel.NewGameView(s.board, "")
+	// 開いた数字マスのクリックは両押し
+	if s.board.Contains(x, y) && s.board.Cells[y][x].IsRevealed {
+		s.board.Chord(x, y)
+	} else {
+		s.board.Open(x, y)
+	}
+	report := ""
+	if s.board.Err != nil {
+		report = s.board.Err.Error()
+	} else if s.board.IsFinished() && s.stats.Hints > 0 {
+		report = fmt.Sprintf("Finished with %d hints", s.stats.Hints)
+	}
+	return s.render(report, nil)
 }
 
 func (s *GameSession) ToggleFlag(x, y int) string {
@@ -64,58 +192,106 @@ func (s *GameSession) ToggleFlag(x, y int) string {
 		return "{}"
 	}
 	s.board.ToggleFlag(x, y)
-	return viewmodel.NewGameView(s.board, "")
+	// 旗のせいで盤面が矛盾したら、原因の旗を知らせる
+	return s.renderView("", s.contradiction())
+}
+
+// contradiction は盤面が矛盾していれば、外すべき旗の組を表示用に返します
+func (s *GameSession) contradiction() *viewmodel.MoveView {
+	bot, err := s.solver()
+	if err != nil {
+		return nil
+	}
+	// 旗のクリックごとに呼ばれるので、Bot の1手と同じ時間で打ち切る
+	ctx, cancel := context.WithTimeout(context.Background(), stepTimeout)
+	defer cancel()
+	c := bot.FindContradictionContext(ctx)
+	if c == nil {
+		return nil
+	}
+	v := viewmodel.NewMoveView(&c.Moves()[0])
+	v.Flags = nil
+	for _, p := range c.Flags {
+		v.Flags = append(v.Flags, viewmodel.Point{X: p.X, Y: p.Y})
+	}
+	return v
 }
 
 // BotStep: Botに1手進めさせ、統計を取ります
 func (s *GameSession) BotStep() string {
-	if s.board == nil || s.board.CheckClear() {
+	if s.board == nil || s.board.IsFinished() {
 		return "{}"
 	}
-	// モードを指定してSolverを作成
-	bot := solver.New(s.board, s.mode)
-
-	var move *solver.Move
-	if move = bot.NextMove(); move != nil {
-		// 戦略ごとの統計カウント
-		switch move.Strategy {
-		case "Logic", "Advanced", "Tank":
-			s.stats.Logic++
-		case "AI", "PureAI", "Tank(Prob)": // AI関連
-			s.stats.AI++
-		case "Random":
-			s.stats.Random++
-		}
+	bot, err := s.solver()
+	if err != nil {
+		return s.render(err.Error(), nil)
+	}
 
-		// 行動実行
-		if move.Type == solver.MoveOpen {
-			s.board.Open(move.X, move.Y)
-		} else {
-			s.board.ToggleFlag(move.X, move.Y)
-		}
+	t := time.Now()
+	move := nextMove(bot)
+	if move != nil {
+		// 行動実行と段階ごとの集計
+		d := time.Since(t)
+		s.stats.Step(d)
+		s.stats.Apply(s.board, *move, d)
 	}
 
 	// レポート作成
 	report := ""
 	isGameOver := false
-	if move != nil && move.Type == solver.MoveOpen {
-		// 範囲内チェック
-		if move.Y >= 0 && move.Y < s.board.Height && move.X >= 0 && move.X < s.board.Width {
-			if s.board.Cells[move.Y][move.X].IsMine && s.board.Cells[move.Y][move.X].IsRevealed {
-				isGameOver = true
-			}
-		}
+	if move != nil && (move.Type == solver.MoveOpen || move.Type == solver.MoveChord) {
+		isGameOver = s.board.IsGameOver
 	}
 
 	if isGameOver {
-		report = fmt.Sprintf("💥 GAME OVER\n----------------\nLogic : %d\nAI    : %d\nRandom: %d\n\nLast Move: %s (Confidence: %.1f%%)",
-			s.stats.Logic, s.stats.AI, s.stats.Random, move.Strategy, move.Confidence*100)
+		report = fmt.Sprintf("💥 GAME OVER\n----------------\n%s\n\nLast Move: %s (Confidence: %.1f%%)\nWhy   : %s",
+			summary(&s.stats), move.Strategy, move.Confidence*100, move.Reason)
 	} else if s.board.CheckClear() {
-		report = fmt.Sprintf("🎉 GAME CLEAR\n----------------\nLogic : %d\nAI    : %d\nRandom: %d",
-			s.stats.Logic, s.stats.AI, s.stats.Random)
+		report = fmt.Sprintf("🎉 GAME CLEAR\n----------------\n%s", summary(&s.stats))
+	} else if s.board.IsTimeUp() {
+		report = fmt.Sprintf("⏱ TIME UP\n----------------\nScore : %d\n%s", s.board.Score, summary(&s.stats))
+	}
+	if report != "" && s.board.Clicks > 0 {
+		report += fmt.Sprintf("\nClicks: %d (3BV %d, efficiency %.0f%%)", s.board.Clicks, s.board.BBBV(), s.board.Efficiency()*100)
+	}
+	if report != "" && s.stats.Hints > 0 {
+		report += fmt.Sprintf("\nHints : %d", s.stats.Hints)
+	}
+	if report != "" && s.board.Rules.Win != game.WinRevealAll && s.board.Rules.Win != game.WinTimeAttack {
+		report += fmt.Sprintf("\nRules : %s (Score: %d)", s.board.Rules.Win, s.board.Score)
+	}
+
+	return s.render(report, move)
+}
+
+// Hint: 盤面は変えずに、段階 level (1〜3) のヒントを viewmodel.HintView のJSONで返します
+// 1: 確定手のある範囲, 2: 範囲と手法の名前, 3: 手とその理由
+func (s *GameSession) Hint(level int) string {
+	if s.board == nil || s.board.IsFinished() {
+		return "{}"
+	}
+	bot, err := s.solver()
+	if err != nil {
+		out, _ := json.Marshal(viewmodel.HintView{Level: level, Message: err.Error(), HintsUsed: s.stats.Hints})
+		return string(out)
 	}
 
-	return viewmodel.NewGameView(s.board, report)
+	ctx, cancel := context.WithTimeout(context.Background(), stepTimeout)
+	defer cancel()
+	h := bot.HintContext(ctx, solver.HintLevel(level))
+	if h == nil {
+		return "{}"
+	}
+	s.stats.Hint(s.board) // 同じ局面で段階を上げても1回と数える
+	view := viewmodel.NewHintView(h, s.stats.Hints)
+	if h.Move != nil && h.Move.Type == solver.MoveUnflag {
+		// 外すべき旗の組をまとめて示す
+		if v := s.contradiction(); v != nil {
+			view.Move = v
+		}
+	}
+	out, _ := json.Marshal(view)
+	return string(out)
 }
 
 // --- ベンチマーク機能 ---
@@ -131,90 +307,104 @@ func runBenchmarkWrapper(_ js.Value, args []js.Value) interface{} {
 		callback = args[4]
 	}
 
-	wins := 0
+	var total solver.Stats
 	start := time.Now()
 
-	// 現在のセッションモードを使用
-	benchMode := session.mode
+	if err := game.NewBoard(width, height, mines).CheckMineCount(); err != nil {
+		return err.Error()
+	}
+
+	// 現在のセッションのパイプラインを使用
+	benchPipeline := session.pipeline
+	bot, err := solver.NewFromConfig(nil, benchPipeline)
+	if err != nil {
+		return err.Error()
+	}
 
 	for i := 0; i < runs; i++ {
 		b := game.NewBoard(width, height, mines)
-		bot := solver.New(b, benchMode)
+		bot.SetBoard(b)
 
-		logicCnt, aiCnt, randomCnt := 0, 0, 0
+		var stats solver.Stats
 		var lastMove *solver.Move
-		isWin := false
-
-		for {
-			if b.CheckClear() {
-				wins++
-				isWin = true
+		// 確定手はまとめて適用し、無ければ1手推測する
+		for alive := true; alive && !b.CheckClear(); {
+			t := time.Now()
+			batch := step(bot)
+			if len(batch) == 0 {
 				break
 			}
-			move := bot.NextMove()
-			if move == nil {
-				break
-			}
-			lastMove = move
-
-			switch move.Strategy {
-			case "Logic", "Advanced", "Tank":
-				logicCnt++
-			case "AI", "PureAI", "Tank(Prob)":
-				aiCnt++
-			case "Random":
-				randomCnt++
-			}
-
-			if move.Type == solver.MoveOpen {
-				if !b.Open(move.X, move.Y) {
+			d := time.Since(t)
+			stats.Step(d)
+			for _, move := range batch {
+				lastMove = &move
+				if alive = stats.Apply(b, move, d/time.Duration(len(batch))); !alive {
 					break
 				}
-			} else {
-				b.ToggleFlag(move.X, move.Y)
 			}
 		}
+		stats.EndGame(b)
+		total.Merge(&stats)
 
 		if callback.Type() == js.TypeFunction {
 			resStr := "💥 OVER "
-			if isWin {
+			if stats.Wins > 0 {
 				resStr = "🎉 CLEAR"
 			}
 
 			lastStrat := "-"
 			lastConf := 0.0
 			if lastMove != nil {
-				lastStrat = lastMove.Strategy
+				lastStrat = lastMove.Strategy.String()
 				lastConf = lastMove.Confidence * 100
 			}
 
-			logMsg := fmt.Sprintf("[%03d/%d] %s (L:%d, A:%d, R:%d) Last: %s(%.1f%%)",
-				i+1, runs, resStr, logicCnt, aiCnt, randomCnt, lastStrat, lastConf)
+			kinds := stats.ByKind()
+			logMsg := fmt.Sprintf("[%03d/%d] %s (L:%d, G:%d, R:%d) Last: %s(%.1f%%)",
+				i+1, runs, resStr, kinds[solver.KindDeduction], kinds[solver.KindGuess], kinds[solver.KindRandom], lastStrat, lastConf)
 
 			callback.Invoke(logMsg)
 		}
 	}
 
 	duration := time.Since(start)
-	modeName := "Hybrid"
-	if benchMode == solver.ModePureAI {
-		modeName = "Pure AI"
+	modeName := benchPipeline
+	for _, p := range solver.Presets {
+		if p.Name == benchPipeline {
+			modeName = p.Description
+		}
 	}
 
-	return fmt.Sprintf("Benchmark Finished (%s):\nRuns: %d, Wins: %d (%.1f%%)\nTime: %v\nSpeed: %.0f games/sec",
-		modeName, runs, wins, float64(wins)/float64(runs)*100, duration, float64(runs)/duration.Seconds())
+	report := fmt.Sprintf("Benchmark Finished (%s):\nRuns: %d, Wins: %d (%.1f%%)\nTime: %v\nSpeed: %.0f games/sec",
+		modeName, runs, total.Wins, float64(total.Wins)/float64(runs)*100, duration, float64(runs)/duration.Seconds())
+	if total.Wins > 0 {
+		report += fmt.Sprintf("\nClicks: %.1f per win (3BV %.1f, efficiency %.0f%%)",
+			float64(total.Clicks)/float64(total.Wins), float64(total.BBBV)/float64(total.Wins), float64(total.BBBV)/float64(total.Clicks)*100)
+	}
+	return report + "\n\n" + total.Table()
+}
+
+// summary は1ゲーム分の集計を、分類ごとの手の数と段階ごとの表にします
+func summary(st *solver.Stats) string {
+	kinds := st.ByKind()
+	return fmt.Sprintf("Logic : %d\nGuess : %d\nRandom: %d\n\n%s",
+		kinds[solver.KindDeduction], kinds[solver.KindGuess], kinds[solver.KindRandom], st.Table())
 }
 
 // --- Wrapper Functions ---
 
 func newGameWrapper(_ js.Value, args []js.Value) interface{} {
 	w, h, m := 10, 10, 10
+	shape := ""
 	if len(args) >= 3 {
 		w = args[0].Int()
 		h = args[1].Int()
 		m = args[2].Int()
 	}
-	return session.NewGame(w, h, m)
+	if len(args) >= 4 && args[3].Type() == js.TypeString {
+		shape = args[3].String()
+	}
+	return session.NewGame(w, h, m, shape)
 }
 
 func openCellWrapper(_ js.Value, args []js.Value) interface{} {
@@ -235,6 +425,31 @@ func botStepWrapper(_ js.Value, args []js.Value) interface{} {
 	return session.BotStep()
 }
 
+// 確率マップ関数 (JSから呼ばれる)
+// 盤面は変えずに、全マスの地雷確率を viewmodel.ProbabilityView のJSONで返します
+func probabilitiesWrapper(_ js.Value, _ []js.Value) interface{} {
+	s := session
+	if s.board == nil || s.board.IsFinished() {
+		return "{}"
+	}
+	bot, err := s.solver()
+	if err != nil {
+		return "{}"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), stepTimeout)
+	defer cancel()
+	return viewmodel.NewProbabilityView(bot.ProbabilitiesContext(ctx))
+}
+
+// 引数: ヒントの段階 (省略時は 3 = 手そのもの)
+func hintWrapper(_ js.Value, args []js.Value) interface{} {
+	level := int(solver.HintMove)
+	if len(args) > 0 && args[0].Type() == js.TypeNumber {
+		level = args[0].Int()
+	}
+	return session.Hint(level)
+}
+
 func main() {
 	c := make(chan struct{})
 
@@ -242,9 +457,14 @@ func main() {
 	js.Global().Set("goOpenCell", js.FuncOf(openCellWrapper))
 	js.Global().Set("goToggleFlag", js.FuncOf(toggleFlagWrapper))
 	js.Global().Set("goBotStep", js.FuncOf(botStepWrapper))
+	js.Global().Set("goHint", js.FuncOf(hintWrapper))
+	js.Global().Set("goProbabilities", js.FuncOf(probabilitiesWrapper))
 	js.Global().Set("goRunBenchmark", js.FuncOf(runBenchmarkWrapper))
 	// 新規追加
 	js.Global().Set("goSetSolverMode", js.FuncOf(setSolverModeWrapper))
+	js.Global().Set("goListPipelines", js.FuncOf(listPipelinesWrapper))
+	js.Global().Set("goSetRules", js.FuncOf(setRulesWrapper))
+	js.Global().Set("goSetPatchMode", js.FuncOf(setPatchModeWrapper))
 
 	println("Go WebAssembly Initialized")
 	<-c
@@ -28,31 +28,145 @@ func NewBoard(width, height, mineCount int) *Board {
 	}
 }
 
-// InitializeMines は最初のクリック位置(safeX, safeY)を避けて地雷を配置します
-func (b *Board) InitializeMines(safeX, safeY int) {
-	// rand.Seedはinitで行っているため削除
+// NewMaskedBoard は形を指定して盤面を作ります (mask が false のマスは存在しない)
+func NewMaskedBoard(width, height, mineCount int, mask [][]bool) *Board {
+	b := NewBoard(width, height, mineCount)
+	b.Mask = mask
+	return b
+}
+
+// Clone は盤面のディープコピーを返します
+// Mask と Distribution と Rand は共有します
+func (b *Board) Clone() *Board {
+	if b == nil {
+		return nil
+	}
+	c := *b
+	c.Cells = make([][]Cell, len(b.Cells))
+	for y := range b.Cells {
+		c.Cells[y] = make([]Cell, len(b.Cells[y]))
+		copy(c.Cells[y], b.Cells[y])
+	}
+	return &c
+}
 
-	minesPlaced := 0
-	for minesPlaced < b.MineCount {
-		x := rand.Intn(b.Width)
-		y := rand.Intn(b.Height)
+// Contains は (x, y) が盤面内かつ存在するマスかどうかを返します
+func (b *Board) Contains(x, y int) bool {
+	if x < 0 || x >= b.Width || y < 0 || y >= b.Height {
+		return false
+	}
+	return b.IsPlayable(x, y)
+}
 
-		// 既に地雷があるならスキップ
-		if b.Cells[y][x].IsMine {
-			continue
+// IsPlayable はマスクで除外されていないかを返します（範囲チェックはしません）
+func (b *Board) IsPlayable(x, y int) bool {
+	if b.Mask == nil {
+		return true
+	}
+	return y < len(b.Mask) && x < len(b.Mask[y]) && b.Mask[y][x]
+}
+
+// PlayableCount は存在するマスの総数を返します
+func (b *Board) PlayableCount() int {
+	if b.Mask == nil {
+		return b.Width * b.Height
+	}
+	count := 0
+	for y := 0; y < b.Height; y++ {
+		for x := 0; x < b.Width; x++ {
+			if b.IsPlayable(x, y) {
+				count++
+			}
 		}
+	}
+	return count
+}
+
+// CheckMineCount は最初のクリックがどこでも MineCount 個の地雷を置ける設定かを確かめます
+// 盤面を作る側 (NewGame やコマンドのフラグ) で、最初のクリックより前に呼んで設定を断るのに使います
+// 地雷を置けるのは Distribution の重みが正のマスだけです
+// 重みが乱数で決まる分布は固定の種で1回だけ試すので、b.Rand は進めません
+func (b *Board) CheckMineCount() error {
+	if b.MineCount < 0 {
+		return fmt.Errorf("invalid mine count: %d", b.MineCount)
+	}
+	dist := b.Distribution
+	if dist == nil {
+		dist = Uniform{}
+	}
+	probe := b.Clone()
+	probe.Rand = rand.New(rand.NewSource(1))
+	weights := dist.Weights(probe)
 
-		// 初回クリック位置の「周囲9マス」には地雷を置かない
-		if x >= safeX-1 && x <= safeX+1 && y >= safeY-1 && y <= safeY+1 {
-			continue
+	// 地雷を置けるマスの数と、最初のクリックで守られるそのようなマスの最大数
+	room, protected := 0, 0
+	for y := 0; y < b.Height; y++ {
+		for x := 0; x < b.Width; x++ {
+			if !b.IsPlayable(x, y) {
+				continue
+			}
+			if weights[y][x] > 0 {
+				room++
+			}
+			n := 0
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if b.Contains(nx, ny) && weights[ny][nx] > 0 && b.Rules.FirstClick.protects(x, y, nx, ny) {
+						n++
+					}
+				}
+			}
+			protected = max(protected, n)
 		}
+	}
+	if room -= protected; b.MineCount > room {
+		return fmt.Errorf("too many mines: %d (at most %d fit with the %s first click rule and the mine distribution)", b.MineCount, max(room, 0), b.Rules.FirstClick)
+	}
+	return nil
+}
 
-		b.Cells[y][x].IsMine = true
-		minesPlaced++
+// InitializeMines は最初のクリック位置(safeX, safeY)を避けて地雷を配置します
+// 配置は Distribution に従います。地雷を置けるマスが MineCount より少ない場合は
+// 何も置かずにエラーを返します (盤面は初期化前のまま)
+func (b *Board) InitializeMines(safeX, safeY int) error {
+	dist := b.Distribution
+	if dist == nil {
+		dist = Uniform{}
+	}
+	if b.Rand == nil {
+		b.Rand = rand.New(rand.NewSource(rand.Int63()))
+	}
+	weights := dist.Weights(b)
+
+	candidates := []int{}
+	candWeights := []float64{}
+	for y := 0; y < b.Height; y++ {
+		for x := 0; x < b.Width; x++ {
+			if !b.IsPlayable(x, y) {
+				continue
+			}
+			// 初回クリック位置の周り (既定では周囲9マス) には地雷を置かない
+			if b.Rules.FirstClick.protects(safeX, safeY, x, y) {
+				continue
+			}
+			candidates = append(candidates, y*b.Width+x)
+			candWeights = append(candWeights, weights[y][x])
+		}
+	}
+
+	picked := pickWeighted(b.Rand, candidates, candWeights, b.MineCount)
+	if len(picked) < b.MineCount {
+		return fmt.Errorf("cannot place %d mines: only %d cells can hold a mine", b.MineCount, len(picked))
+	}
+	for _, idx := range picked {
+		b.Cells[idx/b.Width][idx%b.Width].IsMine = true
 	}
 
 	b.calculateNeighbors()
 	b.IsInitialized = true
+	b.StartedAt = time.Now()
+	return nil
 }
 
 func (b *Board) calculateNeighbors() {
@@ -69,7 +183,7 @@ func (b *Board) calculateNeighbors() {
 					}
 					ny := y + dy
 					nx := x + dx
-					if nx >= 0 && nx < b.Width && ny >= 0 && ny < b.Height {
+					if b.Contains(nx, ny) {
 						if b.Cells[ny][nx].IsMine {
 							count++
 						}
@@ -81,47 +195,125 @@ func (b *Board) calculateNeighbors() {
 	}
 }
 
-// Open
+// Open はマスを開けます。地雷を開けた場合は false を返します
+// 最初のクリックで地雷を置けなかった場合も、理由を Err に記録して false を返します (何も開きません)
 func (b *Board) Open(x, y int) bool {
-	if x < 0 || x >= b.Width || y < 0 || y >= b.Height {
+	if !b.Contains(x, y) || b.IsTimeUp() {
 		return true
 	}
 
-	if !b.IsInitialized {
-		b.InitializeMines(x, y)
+	firstClick := !b.IsInitialized
+	if firstClick {
+		// 地雷を置けない設定では開けない (CheckMineCount で先に断ってください)
+		if err := b.InitializeMines(x, y); err != nil {
+			b.Err = err
+			return false
+		}
 	}
 
-	cell := &b.Cells[y][x]
+	cell := b.Cells[y][x]
 	if cell.IsRevealed || cell.IsFlagged {
 		return true
 	}
+	b.Clicks++
+	// 周囲に手がかりが1つもないマスを開けるのは当てずっぽう
+	guess := !firstClick && !b.hasRevealedNeighbor(x, y)
+
+	safe, revealed := b.open(x, y)
+	if safe {
+		b.addScore(revealed, cell.NeighborCount == 0, guess)
+	}
+	return safe
+}
+
+// open は連鎖を含めてマスを開け、開いた安全マスの数を返します
+func (b *Board) open(x, y int) (bool, int) {
+	if !b.Contains(x, y) {
+		return true, 0
+	}
+
+	cell := &b.Cells[y][x]
+	if cell.IsRevealed || cell.IsFlagged {
+		return true, 0
+	}
 
 	cell.IsRevealed = true
 
 	if cell.IsMine {
 		b.IsGameOver = true
-		return false // ゲームオーバー
+		return false, 0 // ゲームオーバー
 	}
 
+	revealed := 1
 	if cell.NeighborCount == 0 {
 		for dy := -1; dy <= 1; dy++ {
 			for dx := -1; dx <= 1; dx++ {
 				if dx != 0 || dy != 0 {
-					b.Open(x+dx, y+dy)
+					_, n := b.open(x+dx, y+dy)
+					revealed += n
 				}
 			}
 		}
 	}
-	return true
+	return true, revealed
+}
+
+// Chord は開いた数字マス (x, y) の周りの旗が数字と同じ数なら、旗の無い周りのマスをまとめて開けます (両押し)
+// 旗が間違っていて地雷を開けた場合は false を返します。条件を満たさない場合は何もせず true を返します
+func (b *Board) Chord(x, y int) bool {
+	if !b.Contains(x, y) || b.IsTimeUp() {
+		return true
+	}
+	cell := b.Cells[y][x]
+	if !cell.IsRevealed || cell.NeighborCount == 0 {
+		return true
+	}
+	flags, hidden := 0, 0
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			if (dx == 0 && dy == 0) || !b.Contains(x+dx, y+dy) {
+				continue
+			}
+			if n := b.Cells[y+dy][x+dx]; n.IsFlagged {
+				flags++
+			} else if !n.IsRevealed {
+				hidden++
+			}
+		}
+	}
+	if flags != cell.NeighborCount || hidden == 0 {
+		return true
+	}
+
+	b.Clicks++
+	safe := true
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			nx, ny := x+dx, y+dy
+			if (dx == 0 && dy == 0) || !b.Contains(nx, ny) {
+				continue
+			}
+			ok, revealed := b.open(nx, ny)
+			if !ok {
+				safe = false
+				continue
+			}
+			if revealed > 0 {
+				b.addScore(revealed, b.Cells[ny][nx].NeighborCount == 0, false)
+			}
+		}
+	}
+	return safe
 }
 
 func (b *Board) ToggleFlag(x, y int) {
-	if x < 0 || x >= b.Width || y < 0 || y >= b.Height {
+	if !b.Contains(x, y) || b.IsTimeUp() {
 		return
 	}
 	cell := &b.Cells[y][x]
 	if !cell.IsRevealed {
 		cell.IsFlagged = !cell.IsFlagged
+		b.Clicks++
 	}
 }
 
@@ -141,7 +333,15 @@ func (b *Board) GetFlagCount() int {
 	return count
 }
 
+// CheckClear はルールの勝利条件を満たしたかどうかを返します
 func (b *Board) CheckClear() bool {
+	if !b.IsInitialized {
+		return false
+	}
+	if b.Rules.Win == WinFlagAll {
+		return !b.IsGameOver && b.allMinesFlagged()
+	}
+
 	revealedCount := 0
 	for y := 0; y < b.Height; y++ {
 		for x := 0; x < b.Width; x++ {
@@ -150,5 +350,5 @@ func (b *Board) CheckClear() bool {
 			}
 		}
 	}
-	return (b.Width*b.Height - revealedCount) == b.MineCount
+	return (b.PlayableCount() - revealedCount) == b.MineCount
 }
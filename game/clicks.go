@@ -0,0 +1,62 @@
+package game
+
+// BBBV は盤面の 3BV (Bechtel's Board Benchmark Value) を返します
+// 全ての安全マスを左クリックだけで開けるのに必要な最小のクリック数で、
+// 0 がつながった領域 (オープニング) 1つにつき 1、どのオープニングにも接していない数字マス1つにつき 1 です
+// 地雷を置く前 (初手前) は 0 を返します
+func (b *Board) BBBV() int {
+	if !b.IsInitialized {
+		return 0
+	}
+	seen := make([][]bool, b.Height)
+	for y := range seen {
+		seen[y] = make([]bool, b.Width)
+	}
+
+	count := 0
+	for y := 0; y < b.Height; y++ {
+		for x := 0; x < b.Width; x++ {
+			c := b.Cells[y][x]
+			if seen[y][x] || c.IsMine || c.NeighborCount != 0 || !b.IsPlayable(x, y) {
+				continue
+			}
+			// オープニング1つ分: 0 のマスをたどり、周りの数字マスも開いたことにする
+			count++
+			seen[y][x] = true
+			stack := [][2]int{{x, y}}
+			for len(stack) > 0 {
+				p := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				for dy := -1; dy <= 1; dy++ {
+					for dx := -1; dx <= 1; dx++ {
+						nx, ny := p[0]+dx, p[1]+dy
+						if !b.Contains(nx, ny) || seen[ny][nx] {
+							continue
+						}
+						seen[ny][nx] = true
+						if b.Cells[ny][nx].NeighborCount == 0 {
+							stack = append(stack, [2]int{nx, ny})
+						}
+					}
+				}
+			}
+		}
+	}
+	for y := 0; y < b.Height; y++ {
+		for x := 0; x < b.Width; x++ {
+			if !seen[y][x] && !b.Cells[y][x].IsMine && b.IsPlayable(x, y) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// Efficiency は 3BV をクリック数で割った値です (1 を超えると、両押しで左クリックだけより少なく済んだ)
+// クリックしていなければ 0 を返します。終わった盤面で使います
+func (b *Board) Efficiency() float64 {
+	if b.Clicks == 0 {
+		return 0
+	}
+	return float64(b.BBBV()) / float64(b.Clicks)
+}
@@ -0,0 +1,25 @@
+package game
+
+// CellChange は2つの盤面の間で見た目が変わったマス
+type CellChange struct {
+	X, Y int
+	Cell Cell // next 側のマスの状態
+}
+
+// Diff は prev から next への変化 (開いた・旗の付け外し) を返します
+// 盤面のサイズが違う、または prev が nil の場合は ok = false を返します
+// 初回クリックによる地雷配置のような、見た目に出ない変化は含みません
+func Diff(prev, next *Board) (changes []CellChange, ok bool) {
+	if prev == nil || next == nil || prev.Width != next.Width || prev.Height != next.Height {
+		return nil, false
+	}
+	for y := 0; y < next.Height; y++ {
+		for x := 0; x < next.Width; x++ {
+			p, n := prev.Cells[y][x], next.Cells[y][x]
+			if p.IsRevealed != n.IsRevealed || p.IsFlagged != n.IsFlagged {
+				changes = append(changes, CellChange{X: x, Y: y, Cell: n})
+			}
+		}
+	}
+	return changes, true
+}
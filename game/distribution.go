@@ -0,0 +1,218 @@
+package game
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// MineDistribution は地雷配置の確率分布を表します
+// Weights は各マスの相対的な重みを返し、重みが 0 以下のマスには地雷を置きません
+// InitializeMines から呼ばれ、乱数が必要なら b.Rand を使います
+type MineDistribution interface {
+	Weights(b *Board) [][]float64
+}
+
+// Uniform は全マス等確率の分布（従来の配置）
+type Uniform struct{}
+
+func (Uniform) Weights(b *Board) [][]float64 {
+	return filledWeights(b.Width, b.Height, 1.0)
+}
+
+// Clustered は地雷がいくつかの塊に集まる分布
+// 塊の中心は盤面ごとにランダムに選ばれます
+type Clustered struct {
+	Clusters int     // 塊の数 (0 なら盤面サイズから自動決定)
+	Radius   float64 // 塊の広がり (0 なら自動決定)
+	Floor    float64 // 塊の外側に残す最低限の重み
+}
+
+func (c Clustered) Weights(b *Board) [][]float64 {
+	clusters := c.Clusters
+	if clusters <= 0 {
+		clusters = b.Width*b.Height/40 + 1
+	}
+	radius := c.Radius
+	if radius <= 0 {
+		radius = math.Max(1.5, math.Sqrt(float64(b.Width*b.Height)/float64(clusters))/2)
+	}
+
+	type center struct{ x, y float64 }
+	centers := make([]center, clusters)
+	for i := range centers {
+		centers[i] = center{b.Rand.Float64() * float64(b.Width), b.Rand.Float64() * float64(b.Height)}
+	}
+
+	weights := filledWeights(b.Width, b.Height, c.Floor)
+	for y := 0; y < b.Height; y++ {
+		for x := 0; x < b.Width; x++ {
+			for _, ct := range centers {
+				dx, dy := float64(x)-ct.x, float64(y)-ct.y
+				weights[y][x] += math.Exp(-(dx*dx + dy*dy) / (2 * radius * radius))
+			}
+		}
+	}
+	return weights
+}
+
+// Gradient は盤面の端から端へ密度が線形に変化する分布
+type Gradient struct {
+	Start    float64 // 左端（Vertical なら上端）の重み
+	End      float64 // 右端（Vertical なら下端）の重み
+	Vertical bool
+}
+
+func (g Gradient) Weights(b *Board) [][]float64 {
+	weights := filledWeights(b.Width, b.Height, 0)
+	for y := 0; y < b.Height; y++ {
+		for x := 0; x < b.Width; x++ {
+			t := ratio(x, b.Width)
+			if g.Vertical {
+				t = ratio(y, b.Height)
+			}
+			weights[y][x] = g.Start + (g.End-g.Start)*t
+		}
+	}
+	return weights
+}
+
+// DensityMap は領域ごとの密度を与える分布
+// Grid は盤面全体に引き伸ばして適用されるため、盤面より小さくても構いません
+type DensityMap struct {
+	Grid [][]float64
+}
+
+func (d DensityMap) Weights(b *Board) [][]float64 {
+	weights := filledWeights(b.Width, b.Height, 0)
+	rows := len(d.Grid)
+	if rows == 0 {
+		return weights
+	}
+	for y := 0; y < b.Height; y++ {
+		row := d.Grid[y*rows/b.Height]
+		if len(row) == 0 {
+			continue
+		}
+		for x := 0; x < b.Width; x++ {
+			weights[y][x] = row[x*len(row)/b.Width]
+		}
+	}
+	return weights
+}
+
+// Rect は盤面上の矩形領域
+type Rect struct {
+	X, Y, W, H int
+}
+
+func (r Rect) Contains(x, y int) bool {
+	return x >= r.X && x < r.X+r.W && y >= r.Y && y < r.Y+r.H
+}
+
+// Forbidden は別の分布に「地雷禁止区域」を重ねます
+type Forbidden struct {
+	Base  MineDistribution // nil なら Uniform
+	Zones []Rect
+}
+
+func (f Forbidden) Weights(b *Board) [][]float64 {
+	base := f.Base
+	if base == nil {
+		base = Uniform{}
+	}
+	weights := base.Weights(b)
+	for y := 0; y < b.Height; y++ {
+		for x := 0; x < b.Width; x++ {
+			for _, z := range f.Zones {
+				if z.Contains(x, y) {
+					weights[y][x] = 0
+					break
+				}
+			}
+		}
+	}
+	return weights
+}
+
+// DistributionNames は ParseDistribution が受け付ける名前の一覧
+var DistributionNames = []string{"uniform", "cluster", "gradient", "vgradient", "center", "border"}
+
+// ParseDistribution は名前から分布を作成します（cmd/gen などのフラグ用）
+func ParseDistribution(name string) (MineDistribution, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "uniform":
+		return Uniform{}, nil
+	case "cluster":
+		return Clustered{Floor: 0.05}, nil
+	case "gradient":
+		return Gradient{Start: 0.2, End: 1.0}, nil
+	case "vgradient":
+		return Gradient{Start: 0.2, End: 1.0, Vertical: true}, nil
+	case "center":
+		// 中央が濃く外周が薄い
+		return DensityMap{Grid: [][]float64{
+			{0.3, 0.5, 0.3},
+			{0.5, 1.0, 0.5},
+			{0.3, 0.5, 0.3},
+		}}, nil
+	case "border":
+		// 外周が濃く中央が薄い
+		return DensityMap{Grid: [][]float64{
+			{1.0, 0.6, 1.0},
+			{0.6, 0.2, 0.6},
+			{1.0, 0.6, 1.0},
+		}}, nil
+	}
+	return nil, fmt.Errorf("unknown distribution: %q", name)
+}
+
+// pickWeighted は重み付きで count 個のマスを非復元抽出します (Efraimidis-Spirakis法)
+func pickWeighted(rng *rand.Rand, candidates []int, weights []float64, count int) []int {
+	type keyed struct {
+		idx int
+		key float64
+	}
+	keys := make([]keyed, 0, len(candidates))
+	for i, c := range candidates {
+		if weights[i] <= 0 {
+			continue
+		}
+		// log(u)/w が大きい順に取ると、重みに比例した非復元抽出になる
+		u := rng.Float64()
+		for u == 0 {
+			u = rng.Float64()
+		}
+		keys = append(keys, keyed{c, math.Log(u) / weights[i]})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].key > keys[j].key })
+
+	if count > len(keys) {
+		count = len(keys)
+	}
+	picked := make([]int, count)
+	for i := 0; i < count; i++ {
+		picked[i] = keys[i].idx
+	}
+	return picked
+}
+
+func filledWeights(width, height int, v float64) [][]float64 {
+	weights := make([][]float64, height)
+	for y := range weights {
+		weights[y] = make([]float64, width)
+		for x := range weights[y] {
+			weights[y][x] = v
+		}
+	}
+	return weights
+}
+
+func ratio(i, n int) float64 {
+	if n <= 1 {
+		return 0
+	}
+	return float64(i) / float64(n-1)
+}
@@ -0,0 +1,179 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// WinCondition はゲームの勝利条件
+type WinCondition int
+
+const (
+	WinRevealAll   WinCondition = iota // 安全マスを全て開ける (従来ルール)
+	WinFlagAll                         // 全ての地雷に正しく旗を立てる
+	WinTimeAttack                      // 制限時間内に開けた安全マスの数がスコア
+	WinScoreAttack                     // オープニングで加点、当てずっぽうで減点
+)
+
+// スコアアタックの配点
+const (
+	ScorePerCell    = 1  // 安全マス1つあたり
+	ScoreOpening    = 10 // 0のマスを開けて連鎖させたときのボーナス
+	ScoreGuessPenal = 5  // 手がかりのないマスを開けたときの減点
+)
+
+// DefaultTimeLimit はタイムアタックで制限時間が未設定のときの値
+const DefaultTimeLimit = 60 * time.Second
+
+// FirstClickRule は最初のクリックで地雷を避ける範囲
+type FirstClickRule int
+
+const (
+	FirstClickOpening FirstClickRule = iota // 周囲9マスに地雷を置かない (必ず0が開く、従来ルール)
+	FirstClickSafe                          // クリックしたマスだけ地雷を置かない
+	FirstClickAny                           // 何も避けない (初手で地雷を踏むことがある)
+)
+
+// FirstClickNames は ParseFirstClick が受け付ける名前の一覧
+var FirstClickNames = []string{"opening", "safe", "any"}
+
+func (f FirstClickRule) String() string {
+	if int(f) >= 0 && int(f) < len(FirstClickNames) {
+		return FirstClickNames[f]
+	}
+	return fmt.Sprintf("FirstClickRule(%d)", int(f))
+}
+
+// ParseFirstClick は名前から初手のルールを返します
+func ParseFirstClick(name string) (FirstClickRule, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return FirstClickOpening, nil
+	}
+	for i, n := range FirstClickNames {
+		if n == name {
+			return FirstClickRule(i), nil
+		}
+	}
+	return FirstClickOpening, fmt.Errorf("unknown first click rule: %q", name)
+}
+
+// protects は最初のクリック (sx, sy) に対して (x, y) に地雷を置かないかどうかを返します
+func (f FirstClickRule) protects(sx, sy, x, y int) bool {
+	switch f {
+	case FirstClickSafe:
+		return x == sx && y == sy
+	case FirstClickAny:
+		return false
+	}
+	return x >= sx-1 && x <= sx+1 && y >= sy-1 && y <= sy+1
+}
+
+// Ruleset は盤面のルール設定
+type Ruleset struct {
+	Win        WinCondition
+	TimeLimit  time.Duration  // WinTimeAttack の制限時間 (0 なら DefaultTimeLimit)
+	FirstClick FirstClickRule // 最初のクリックで地雷を避ける範囲
+}
+
+// WinConditionNames は ParseWinCondition が受け付ける名前の一覧
+var WinConditionNames = []string{"classic", "flags", "time", "score"}
+
+func (w WinCondition) String() string {
+	if int(w) >= 0 && int(w) < len(WinConditionNames) {
+		return WinConditionNames[w]
+	}
+	return fmt.Sprintf("WinCondition(%d)", int(w))
+}
+
+// ParseWinCondition は名前から勝利条件を返します
+func ParseWinCondition(name string) (WinCondition, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return WinRevealAll, nil
+	}
+	for i, n := range WinConditionNames {
+		if n == name {
+			return WinCondition(i), nil
+		}
+	}
+	return WinRevealAll, fmt.Errorf("unknown win condition: %q", name)
+}
+
+// timeLimit は実際に使う制限時間を返します
+func (r Ruleset) timeLimit() time.Duration {
+	if r.TimeLimit > 0 {
+		return r.TimeLimit
+	}
+	return DefaultTimeLimit
+}
+
+// TimeLeft はタイムアタックの残り時間を返します (それ以外のルールでは 0)
+func (b *Board) TimeLeft() time.Duration {
+	if b.Rules.Win != WinTimeAttack {
+		return 0
+	}
+	if !b.IsInitialized {
+		return b.Rules.timeLimit()
+	}
+	left := b.Rules.timeLimit() - time.Since(b.StartedAt)
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+// IsTimeUp はタイムアタックの制限時間が過ぎたかどうかを返します
+func (b *Board) IsTimeUp() bool {
+	return b.Rules.Win == WinTimeAttack && b.IsInitialized && b.TimeLeft() == 0
+}
+
+// IsFinished はこれ以上操作できない状態かどうかを返します
+func (b *Board) IsFinished() bool {
+	return b.IsGameOver || b.Err != nil || b.IsTimeUp() || b.CheckClear()
+}
+
+// addScore は Open 1回分の結果をルールに応じてスコアに反映します
+func (b *Board) addScore(revealed int, opening, guess bool) {
+	switch b.Rules.Win {
+	case WinTimeAttack:
+		b.Score += revealed
+	case WinScoreAttack:
+		b.Score += revealed * ScorePerCell
+		if opening {
+			b.Score += ScoreOpening
+		}
+		if guess {
+			b.Score -= ScoreGuessPenal
+		}
+	}
+}
+
+// allMinesFlagged は旗と地雷が過不足なく一致しているかを返します
+func (b *Board) allMinesFlagged() bool {
+	for y := 0; y < b.Height; y++ {
+		for x := 0; x < b.Width; x++ {
+			c := b.Cells[y][x]
+			if c.IsMine != c.IsFlagged {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// hasRevealedNeighbor は周囲に開いたマスがあるか (=手がかりがあるか) を返します
+func (b *Board) hasRevealedNeighbor(x, y int) bool {
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			if dx == 0 && dy == 0 {
+				continue
+			}
+			if b.Contains(x+dx, y+dy) && b.Cells[y+dy][x+dx].IsRevealed {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package game
+
+import "sync"
+
+// Session は1つの盤面を複数のゴルーチンから安全に操作するための型です
+// 操作と、その直後の盤面のスナップショット取得を1回のロックで行います
+type Session struct {
+	mu    sync.Mutex
+	board *Board
+}
+
+// NewSession は盤面 b を管理するセッションを作ります
+func NewSession(b *Board) *Session {
+	return &Session{board: b}
+}
+
+// Reset は盤面を差し替え、そのスナップショットを返します
+func (s *Session) Reset(b *Board) *Board {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.board = b
+	return b.Clone()
+}
+
+// Open はマスを開け、結果と開けた直後のスナップショットを返します
+func (s *Session) Open(x, y int) (bool, *Board) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ok := s.board.Open(x, y)
+	return ok, s.board.Clone()
+}
+
+// ToggleFlag は旗を切り替え、直後のスナップショットを返します
+func (s *Session) ToggleFlag(x, y int) *Board {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.board.ToggleFlag(x, y)
+	return s.board.Clone()
+}
+
+// Update は任意の操作 fn をロック中に実行し、直後のスナップショットを返します
+// fn の中で盤面への参照を外に持ち出してはいけません
+func (s *Session) Update(fn func(b *Board)) *Board {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s.board)
+	return s.board.Clone()
+}
+
+// Snapshot は現在の盤面のコピーを返します
+func (s *Session) Snapshot() *Board {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.board.Clone()
+}
@@ -0,0 +1,93 @@
+package game
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ShapeNames は ParseShape が受け付ける形の一覧
+var ShapeNames = []string{"rect", "circle", "heart", "donut", "cross"}
+
+// ParseShape は名前から width x height のマスクを作ります ("rect" は nil)
+func ParseShape(name string, width, height int) ([][]bool, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "rect":
+		return nil, nil
+	case "circle":
+		return CircleMask(width, height), nil
+	case "heart":
+		return HeartMask(width, height), nil
+	case "donut":
+		return DonutMask(width, height), nil
+	case "cross":
+		return CrossMask(width, height), nil
+	}
+	return nil, fmt.Errorf("unknown shape: %q", name)
+}
+
+// ParseMask はレベルデザイン用の文字列からマスクを作ります
+// '.' や ' ' は存在しないマス、それ以外は存在するマスとして扱います
+func ParseMask(rows []string) [][]bool {
+	width := 0
+	for _, r := range rows {
+		if len(r) > width {
+			width = len(r)
+		}
+	}
+	mask := make([][]bool, len(rows))
+	for y, r := range rows {
+		mask[y] = make([]bool, width)
+		for x := 0; x < len(r); x++ {
+			mask[y][x] = r[x] != '.' && r[x] != ' '
+		}
+	}
+	return mask
+}
+
+// CircleMask は盤面に内接する楕円のマスク
+func CircleMask(width, height int) [][]bool {
+	return maskFunc(width, height, func(u, v float64) bool {
+		return u*u+v*v <= 1.0
+	})
+}
+
+// HeartMask はハート型のマスク
+func HeartMask(width, height int) [][]bool {
+	return maskFunc(width, height, func(u, v float64) bool {
+		// (x^2 + y^2 - 1)^3 - x^2 y^3 <= 0 を盤面に合わせて拡大
+		x := u * 1.25
+		y := -v*1.25 + 0.2
+		a := x*x + y*y - 1
+		return a*a*a-x*x*y*y*y <= 0
+	})
+}
+
+// DonutMask は中央に穴の空いた楕円のマスク
+func DonutMask(width, height int) [][]bool {
+	return maskFunc(width, height, func(u, v float64) bool {
+		r := u*u + v*v
+		return r <= 1.0 && r >= 0.16
+	})
+}
+
+// CrossMask は十字型のマスク
+func CrossMask(width, height int) [][]bool {
+	return maskFunc(width, height, func(u, v float64) bool {
+		return math.Abs(u) <= 0.34 || math.Abs(v) <= 0.34
+	})
+}
+
+// maskFunc は各マスの中心を [-1, 1] に正規化して inside を評価します
+func maskFunc(width, height int, inside func(u, v float64) bool) [][]bool {
+	mask := make([][]bool, height)
+	for y := 0; y < height; y++ {
+		mask[y] = make([]bool, width)
+		for x := 0; x < width; x++ {
+			u := (float64(x)+0.5)/float64(width)*2 - 1
+			v := (float64(y)+0.5)/float64(height)*2 - 1
+			mask[y][x] = inside(u, v)
+		}
+	}
+	return mask
+}
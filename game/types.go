@@ -1,5 +1,10 @@
 package game
 
+import (
+	"math/rand"
+	"time"
+)
+
 type Cell struct {
 	IsMine        bool
 	IsRevealed    bool
@@ -14,4 +19,14 @@ type Board struct {
 	Cells         [][]Cell
 	IsInitialized bool // 初回クリックが終わったかどうか
 	IsGameOver    bool // ゲームオーバーフラグ
+
+	Distribution MineDistribution // 地雷配置の分布 (nil なら一様)
+	Mask         [][]bool         // 盤面の形 (false のマスは存在しない、nil なら長方形)
+	Rand         *rand.Rand       // 地雷配置に使う乱数 (nil なら最初の配置時に作る)。シードを固定すると同じ盤面になります
+
+	Rules     Ruleset   // 勝利条件などのルール
+	Score     int       // タイムアタック・スコアアタックの得点
+	Clicks    int       // 盤面を変えたクリックの数 (開ける・旗・両押し)
+	StartedAt time.Time // 初回クリックの時刻
+	Err       error     // 地雷を置けずにゲームを始められなかった理由 (Open が記録し、以降は終局とみなす)
 }
@@ -1,33 +1,46 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"strconv"
 	"sync"
+	"time"
 
 	"minesweeper/game"
+	"minesweeper/solver"
+	"minesweeper/viewmodel"
 )
 
+// hintTimeout は1回のヒントの解析にかける時間の上限
+const hintTimeout = 2 * time.Second
+
 // Server はゲームの状態とHTTPハンドラを管理します
+// 盤面へのアクセスは全て game.Session 経由で行います
 type Server struct {
-	Board *game.Board
-	Mutex sync.Mutex
+	session *game.Session
+
+	mu    sync.Mutex
+	stats solver.Stats // このゲームの集計 (使われたヒントの数は Hints)
 }
 
 // NewServer はサーバーインスタンスを初期化します
 func NewServer() *Server {
-	s := &Server{}
-	s.StartNewGame() // 初期ゲーム作成
-	return s
+	return &Server{session: game.NewSession(newBoard())}
+}
+
+// StartNewGame はゲームをリセットし、新しい盤面のスナップショットを返します
+func (s *Server) StartNewGame() *game.Board {
+	s.mu.Lock()
+	s.stats = solver.Stats{}
+	s.mu.Unlock()
+	return s.session.Reset(newBoard())
 }
 
-// StartNewGame はゲームをリセットします
-func (s *Server) StartNewGame() {
-	s.Mutex.Lock()
-	defer s.Mutex.Unlock()
-	// 設定はとりあえず固定値
-	s.Board = game.NewBoard(10, 10, 10)
+// newBoard は新規ゲームの盤面を作ります (設定はとりあえず固定値)
+func newBoard() *game.Board {
+	return game.NewBoard(10, 10, 10)
 }
 
 // クライアントへのレスポンス用構造体
@@ -37,42 +50,127 @@ type CellView struct {
 	IsMine        bool   `json:"is_mine"`
 }
 
+// PatchView は差分レスポンスで送るマス1つ分
+type PatchView struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	CellView
+}
+
+// Response は盤面全体 (Cells) か差分 (Patches) のどちらか一方を持ちます
 type Response struct {
-	Cells     [][]CellView `json:"cells"`
+	Cells     [][]CellView `json:"cells,omitempty"`
+	Patches   []PatchView  `json:"patches,omitempty"`
 	GameOver  bool         `json:"game_over"`
 	GameClear bool         `json:"game_clear"`
 }
 
 // HandleNew はゲームリセットAPI
 func (s *Server) HandleNew(w http.ResponseWriter, r *http.Request) {
-	s.StartNewGame()
-	s.sendBoardState(w, false)
+	board := s.StartNewGame()
+	s.sendBoardState(w, board, false)
 }
 
 // HandleOpen はマスを開けるAPI
+// diff=1 を付けると、変化したマスだけを patches として返します
 func (s *Server) HandleOpen(w http.ResponseWriter, r *http.Request) {
 	xStr := r.URL.Query().Get("x")
 	yStr := r.URL.Query().Get("y")
 	x, _ := strconv.Atoi(xStr)
 	y, _ := strconv.Atoi(yStr)
 
-	s.Mutex.Lock()
-	// まだ盤面がない場合は作るなどの安全策を入れても良い
-	if s.Board == nil {
-		s.Board = game.NewBoard(10, 10, 10)
+	if r.URL.Query().Get("diff") == "1" {
+		// 開ける前後のスナップショットを同じロック内で取得する
+		var prev *game.Board
+		isSafe := true
+		board := s.session.Update(func(b *game.Board) {
+			prev = b.Clone()
+			isSafe = b.Open(x, y)
+		})
+		if board.Err != nil {
+			http.Error(w, board.Err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		s.sendBoardPatch(w, prev, board, !isSafe)
+		return
+	}
+
+	// 開けた結果と盤面のスナップショットは同じロック内で取得される
+	isSafe, board := s.session.Open(x, y)
+	if board.Err != nil {
+		// 地雷を置けずにゲームを始められなかった (盤面の設定の誤り)
+		http.Error(w, board.Err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	s.sendBoardState(w, board, !isSafe)
+}
+
+// HandleHint は盤面を変えずにヒントを返すAPI
+// level=1 は確定手のある範囲、2 は範囲と手法の名前、3 は手とその理由を返します (省略時は 1)
+// 初手前や終局でヒントが無い場合は 204 No Content を返します
+// 同じ局面で段階を上げても、使ったヒントは1回と数えます
+func (s *Server) HandleHint(w http.ResponseWriter, r *http.Request) {
+	level := int(solver.HintRegion)
+	if v := r.URL.Query().Get("level"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < int(solver.HintRegion) || n > int(solver.HintMove) {
+			http.Error(w, "level must be 1, 2 or 3", http.StatusBadRequest)
+			return
+		}
+		level = n
+	}
+
+	// スナップショットを解くので、解析中も他のリクエストは盤面を操作できます
+	board := s.session.Snapshot()
+	if board.IsFinished() {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), hintTimeout)
+	defer cancel()
+	hint := solver.New(board, solver.ModeHybrid).HintContext(ctx, solver.HintLevel(level))
+	if hint == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
 	}
-	isSafe := s.Board.Open(x, y)
-	s.Mutex.Unlock()
 
-	s.sendBoardState(w, !isSafe)
+	s.mu.Lock()
+	s.stats.Hint(board)
+	used := s.stats.Hints
+	s.mu.Unlock()
+	writeJSON(w, viewmodel.NewHintView(hint, used))
+}
+
+// sendBoardState は盤面のスナップショットをJSONで返します
+func (s *Server) sendBoardState(w http.ResponseWriter, board *game.Board, isGameOver bool) {
+	writeJSON(w, buildResponse(board, isGameOver))
 }
 
-// sendBoardState は現在の盤面状態をJSONで返します
-func (s *Server) sendBoardState(w http.ResponseWriter, isGameOver bool) {
-	s.Mutex.Lock()
-	defer s.Mutex.Unlock()
+// sendBoardPatch は prev から board への変化したマスだけをJSONで返します
+// ゲームオーバー時は地雷が一斉に表示されるので全体を返します
+func (s *Server) sendBoardPatch(w http.ResponseWriter, prev, board *game.Board, isGameOver bool) {
+	changes, ok := game.Diff(prev, board)
+	if !ok || isGameOver {
+		s.sendBoardState(w, board, isGameOver)
+		return
+	}
+
+	full := buildResponse(board, isGameOver)
+	resp := Response{GameOver: full.GameOver, GameClear: full.GameClear}
+	for _, ch := range changes {
+		resp.Patches = append(resp.Patches, PatchView{X: ch.X, Y: ch.Y, CellView: full.Cells[ch.Y][ch.X]})
+	}
+	writeJSON(w, resp)
+}
 
-	board := s.Board
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// buildResponse は盤面全体のレスポンスを作ります
+func buildResponse(board *game.Board, isGameOver bool) Response {
 	h := board.Height
 	w_len := board.Width
 
@@ -87,6 +185,12 @@ func (s *Server) sendBoardState(w http.ResponseWriter, isGameOver bool) {
 			c := board.Cells[y][x]
 			view := CellView{}
 
+			if !board.IsPlayable(x, y) {
+				view.State = "void"
+				resp.Cells[y][x] = view
+				continue
+			}
+
 			if c.IsRevealed {
 				view.State = "opened"
 				if c.IsMine {
@@ -106,7 +210,5 @@ func (s *Server) sendBoardState(w http.ResponseWriter, isGameOver bool) {
 			resp.Cells[y][x] = view
 		}
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	return resp
 }
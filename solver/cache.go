@@ -0,0 +1,174 @@
+package solver
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"minesweeper/ai"
+	"minesweeper/game"
+)
+
+var (
+	networkOnce sync.Once
+	network     *ai.Network
+)
+
+// defaultNetwork は埋め込みの重みから作った AI を返します
+// 重みの読み込みは最初の1回だけで、以降は同じネットワークを共有します (推論は読み取りのみ)
+func defaultNetwork() *ai.Network {
+	networkOnce.Do(func() {
+		net, err := ai.NewNetwork(game.GetWeightsJSON())
+		if err != nil {
+			fmt.Println("AI Load Error:", err)
+			return
+		}
+		network = net
+	})
+	return network
+}
+
+// segCache はセグメントの数え上げ結果を、セグメントの形 (未開封マスと数字) をキーに覚えておきます
+// 1手進めても、開けたマスや旗に触れていないセグメントは同じキーになるので数え直さずに済みます
+// 直近2回の解析で使った結果だけを残すので、メモリは境界の大きさ程度に収まります
+// セグメント自体は segState が手をまたいで持ち、変わったマスの周りだけ作り直します
+type segCache struct {
+	prev map[string]*segResult
+	next map[string]*segResult
+}
+
+func newSegCache() *segCache {
+	return &segCache{prev: map[string]*segResult{}, next: map[string]*segResult{}}
+}
+
+// rotate は新しい解析の開始時に呼び、前々回から使われていない結果を捨てます
+func (c *segCache) rotate() {
+	c.prev, c.next = c.next, map[string]*segResult{}
+}
+
+func (c *segCache) get(key string) (*segResult, bool) {
+	if sr, ok := c.next[key]; ok {
+		return sr, true
+	}
+	if sr, ok := c.prev[key]; ok {
+		c.next[key] = sr
+		return sr, true
+	}
+	return nil, false
+}
+
+func (c *segCache) put(key string, sr *segResult) {
+	c.next[key] = sr
+}
+
+// segState は前回の解析の盤面とセグメントを覚えておき、次の解析では game.Diff で変わったマスを調べて
+// その周り (変わったマスと隣接マス) に触れるセグメントだけを作り直します
+// 触れていないセグメントは未開封マスもルールも変わらないので、そのまま使います
+type segState struct {
+	board    *game.Board
+	segments []*segment
+}
+
+// update は ts.Board のセグメントを返し、次の解析のために盤面とセグメントを覚えます
+func (st *segState) update(ts *TankSolver) []*segment {
+	dirty, ok := changedArea(st.board, ts.Board)
+	switch {
+	case !ok:
+		st.segments = ts.buildSegments(ts.constraints(nil))
+	case len(dirty) > 0:
+		// 触れたセグメントの数字マスと、変わった範囲の数字マスから作り直す
+		area := make(map[pos]bool, len(dirty))
+		for p := range dirty {
+			area[p] = true
+		}
+		var kept []*segment
+		for _, seg := range st.segments {
+			if seg.touches(dirty) {
+				for _, r := range seg.rules {
+					area[r.at] = true
+				}
+				continue
+			}
+			kept = append(kept, seg)
+		}
+		// 作り直したセグメントが残したセグメントとつながることはない
+		// (つながるなら、その未開封マスか数字マスが変わった範囲に入っている)
+		segments := append(kept, ts.buildSegments(ts.constraints(area))...)
+		w := ts.Board.Width
+		sort.Slice(segments, func(i, j int) bool {
+			a, b := segments[i].unknowns[0], segments[j].unknowns[0]
+			return a.y*w+a.x < b.y*w+b.x
+		})
+		st.segments = segments
+	}
+	st.board = ts.Board.Clone()
+	return st.segments
+}
+
+// changedArea は prev から next で変わったマスとその隣接マスを返します
+// 大きさが違うなど比べられない場合は ok = false です
+func changedArea(prev, next *game.Board) (map[pos]bool, bool) {
+	changes, ok := game.Diff(prev, next)
+	if !ok {
+		return nil, false
+	}
+	dirty := make(map[pos]bool)
+	mark := func(x, y int) {
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				dirty[pos{x + dx, y + dy}] = true
+			}
+		}
+	}
+	for _, c := range changes {
+		mark(c.X, c.Y)
+	}
+	// 開いたままのマスの数字が変わるのは別の盤面なので、その周りも作り直す
+	for y := 0; y < next.Height; y++ {
+		for x := 0; x < next.Width; x++ {
+			p, n := prev.Cells[y][x], next.Cells[y][x]
+			if n.IsRevealed && (p.NeighborCount != n.NeighborCount || p.IsMine != n.IsMine) {
+				mark(x, y)
+			}
+		}
+	}
+	return dirty, true
+}
+
+// touches はセグメントの未開封マスか数字マスが area に入っているかを返します
+func (seg *segment) touches(area map[pos]bool) bool {
+	for _, p := range seg.unknowns {
+		if area[p] {
+			return true
+		}
+	}
+	for _, r := range seg.rules {
+		if area[r.at] {
+			return true
+		}
+	}
+	return false
+}
+
+// signature はセグメントの形を表すキーを返します
+// 解の数はマスの並びとルール (どのマスに何個) だけで決まるので、位置も含めて一致すれば結果も同じです
+func (seg *segment) signature() string {
+	var sb strings.Builder
+	for _, p := range seg.unknowns {
+		sb.WriteString(strconv.Itoa(p.x))
+		sb.WriteByte(',')
+		sb.WriteString(strconv.Itoa(p.y))
+		sb.WriteByte(';')
+	}
+	for _, r := range seg.rules {
+		sb.WriteByte('|')
+		sb.WriteString(strconv.Itoa(r.mines))
+		for _, c := range r.cells {
+			sb.WriteByte(' ')
+			sb.WriteString(strconv.Itoa(c))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,66 @@
+package solver
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"minesweeper/game"
+)
+
+// TestSegmentsIncremental は手をまたいで作り直したセグメントが、毎回盤面全体から作ったものと
+// (マスとルールの順序も含めて) 一致することを確かめます
+// 間違った旗を立てて外す手も混ぜ、旗を外したときに広がるセグメントも調べます
+func TestSegmentsIncremental(t *testing.T) {
+	for g := 0; g < 20; g++ {
+		seed := int64(g)
+		rng := rand.New(rand.NewSource(seed))
+		b := game.NewBoard(30, 16, 99)
+		b.Rand = rand.New(rand.NewSource(seed))
+		b.Open(15, 8)
+
+		st := &segState{}
+		var wrong [][2]int
+		for step := 0; !b.IsFinished(); step++ {
+			got := (&TankSolver{Board: b, segs: st}).createSegments()
+			want := (&TankSolver{Board: b}).createSegments()
+			if err := sameSegments(got, want); err != nil {
+				t.Fatalf("seed %d step %d: %v", seed, step, err)
+			}
+
+			switch r := rng.Intn(8); {
+			case r == 0 && len(wrong) > 0:
+				p := wrong[len(wrong)-1]
+				wrong = wrong[:len(wrong)-1]
+				b.ToggleFlag(p[0], p[1])
+			case r == 1:
+				x, y := rng.Intn(b.Width), rng.Intn(b.Height)
+				if c := b.Cells[y][x]; !c.IsRevealed && !c.IsFlagged && !c.IsMine {
+					b.ToggleFlag(x, y)
+					wrong = append(wrong, [2]int{x, y})
+				}
+			default:
+				if !advance(b, rng) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func sameSegments(got, want []*segment) error {
+	if len(got) != len(want) {
+		return fmt.Errorf("%d segments, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if g, w := got[i].signature(), want[i].signature(); g != w {
+			return fmt.Errorf("segment %d is %s, want %s", i, g, w)
+		}
+		for j, r := range want[i].rules {
+			if got[i].rules[j].at != r.at {
+				return fmt.Errorf("segment %d rule %d is at %v, want %v", i, j, got[i].rules[j].at, r.at)
+			}
+		}
+	}
+	return nil
+}
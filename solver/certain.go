@@ -0,0 +1,177 @@
+package solver
+
+import "context"
+
+// Deducer は1回の解析で見つかる確定手をすべて返せる段階です (CertainMoves で使います)
+// 推測しかしない段階は nil を返します
+type Deducer interface {
+	Certain(ctx context.Context, s *Solver) []Move
+}
+
+// Stepper は確定手を全て、無ければ推測手を1つ、1回の解析で返せる段階です (Step で使います)
+// 実装していない段階では Certain と Next を順に呼びます
+type Stepper interface {
+	Step(ctx context.Context, s *Solver) []Move
+}
+
+// Step は確定手があれば全て、無ければ推測手を1つ返します (CertainMoves と NextMove を合わせたもの)
+// 各段階は1回しか解析しないので、CertainMoves が空のときに NextMove を呼ぶより速くなります
+// 推測手は1つだけなので、IsGuess を見れば推測かどうか分かります
+func (s *Solver) Step() []Move {
+	return s.StepContext(context.Background())
+}
+
+// StepContext は Step と同じですが、ctx が終わると解析を打ち切ります
+// 時間切れの後に選んだ推測手は Approximate が true になります
+func (s *Solver) StepContext(ctx context.Context) []Move {
+	var moves []Move
+	if s.Efficient {
+		moves = s.clickPlan(ctx, true)
+	} else {
+		moves = s.checkedStep(ctx)
+	}
+	if len(moves) == 1 && moves[0].IsGuess && done(ctx) {
+		moves[0].Approximate = true
+	}
+	return moves
+}
+
+// CertainMoves は確定した安全マスと地雷を1回の解析でまとめて返します
+// パイプラインの段階を順に試し、最初に確定手を見つけた段階の結果をすべて返します
+// 推測が必要な局面 (と初手) では空なので、NextMove で推測してください
+// 旗のせいで盤面が矛盾している場合は、外すべき旗 (MoveUnflag) を返します
+func (s *Solver) CertainMoves() []Move {
+	return s.CertainMovesContext(context.Background())
+}
+
+// CertainMovesContext は CertainMoves と同じですが、ctx が終わると解析を打ち切ります
+// 打ち切られた段階の確定手は、数えきれた部分から証明できたものだけです
+func (s *Solver) CertainMovesContext(ctx context.Context) []Move {
+	if s.Efficient {
+		return s.clickPlan(ctx, false)
+	}
+	return s.checkedCertainMoves(ctx)
+}
+
+// checkedCertainMoves は旗の矛盾を確かめてから確定手を集めます
+func (s *Solver) checkedCertainMoves(ctx context.Context) []Move {
+	if !s.Board.IsInitialized {
+		return nil
+	}
+	if s.Pipeline == nil {
+		s.Pipeline = MustParsePipeline(modePresets[s.Mode])
+	}
+	trusted := s.flagsTrusted()
+	if !trusted {
+		if c := s.FindContradictionContext(ctx); c != nil {
+			return c.Moves()
+		}
+	}
+	moves := s.certainMoves(ctx)
+	if trusted {
+		s.trust(moves...)
+	}
+	return moves
+}
+
+// checkedStep は旗の矛盾を確かめてから、確定手か推測手を集めます
+func (s *Solver) checkedStep(ctx context.Context) []Move {
+	if s.Pipeline == nil {
+		s.Pipeline = MustParsePipeline(modePresets[s.Mode])
+	}
+	trusted := s.flagsTrusted()
+	if !trusted {
+		if c := s.FindContradictionContext(ctx); c != nil {
+			return c.Moves()
+		}
+	}
+	moves := s.stepMoves(ctx)
+	if trusted {
+		s.trust(moves...)
+	}
+	return moves
+}
+
+// stepMoves は段階を順に試し、最初に手を返した段階の手を返します
+func (s *Solver) stepMoves(ctx context.Context) []Move {
+	for _, st := range s.Pipeline {
+		if sp, ok := st.(Stepper); ok {
+			if moves := sp.Step(ctx, s); len(moves) > 0 {
+				return moves
+			}
+			continue
+		}
+		if d, ok := st.(Deducer); ok {
+			if moves := d.Certain(ctx, s); len(moves) > 0 {
+				return moves
+			}
+		}
+		if move := st.Next(ctx, s); move != nil {
+			return []Move{*move}
+		}
+	}
+	return nil
+}
+
+func (s *Solver) certainMoves(ctx context.Context) []Move {
+	for _, st := range s.Pipeline {
+		if d, ok := st.(Deducer); ok {
+			if moves := d.Certain(ctx, s); len(moves) > 0 {
+				return moves
+			}
+			continue
+		}
+		// Deducer でない段階は1手だけ調べる
+		move := st.Next(ctx, s)
+		if move == nil {
+			continue
+		}
+		if move.IsGuess {
+			return nil
+		}
+		return []Move{*move}
+	}
+	return nil
+}
+
+// moveSet は同じマスを重複させずに手を集めます
+type moveSet struct {
+	moves []Move
+	seen  map[pos]bool
+	limit int // 0 なら無制限
+}
+
+func newMoveSet(limit int) *moveSet {
+	return &moveSet{seen: make(map[pos]bool), limit: limit}
+}
+
+// add は手を加え、上限に達したら true を返します
+func (ms *moveSet) add(m Move) bool {
+	p := pos{m.X, m.Y}
+	if !ms.seen[p] {
+		ms.seen[p] = true
+		ms.moves = append(ms.moves, m)
+	}
+	return ms.full()
+}
+
+func (ms *moveSet) full() bool {
+	return ms.limit > 0 && len(ms.moves) >= ms.limit
+}
+
+// first は最初の手を返します (無ければ nil)
+func (ms *moveSet) first() *Move {
+	if len(ms.moves) == 0 {
+		return nil
+	}
+	m := ms.moves[0]
+	return &m
+}
+
+// certainAll は確定手の一覧に段階の名前と確信度を付けます
+func certainAll(moves []Move, strategy StrategyID) []Move {
+	for i := range moves {
+		certain(&moves[i], strategy)
+	}
+	return moves
+}
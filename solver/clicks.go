@@ -0,0 +1,227 @@
+package solver
+
+import (
+	"context"
+	"fmt"
+
+	"minesweeper/game"
+)
+
+// clickRounds は地雷だけが確定した場合に、覚えた地雷を使って解き直す回数の上限
+const clickRounds = 8
+
+// Apply は手を盤面に打ち、地雷を開けた場合は false を返します
+func (m Move) Apply(b *game.Board) bool {
+	switch m.Type {
+	case MoveOpen:
+		return b.Open(m.X, m.Y)
+	case MoveChord:
+		return b.Chord(m.X, m.Y)
+	default:
+		b.ToggleFlag(m.X, m.Y)
+		return true
+	}
+}
+
+// ClickPlan はクリック数が少なくなるように、次に打つ確定手をクリックの並びで返します (Efficient 用)
+// 確定した地雷には旗を立てずに覚えておき (旗なし)、旗を立てて両押しした方が得な数字マスがあれば
+// 必要な旗と両押しを、そうでなければ確定して安全なマスを1つ開ける手を返します
+// 両押しの得は「開くマス数 - 足りない旗の数 - 1」で比べます (ZiNi と同じ考え方)
+// 確定手が無い場合は nil を返します (推測は NextMove に任せます)
+func (s *Solver) ClickPlan() []Move {
+	return s.clickPlan(context.Background(), false)
+}
+
+// clickPlan は ctx が終わると解析を打ち切る ClickPlan です
+// guess なら、確定手が無い場合に同じ解析で見つかった推測手を1つ返します (Step 用)
+func (s *Solver) clickPlan(ctx context.Context, guess bool) []Move {
+	b := s.Board
+	if !b.IsInitialized {
+		if guess {
+			return one(s.nextMove(ctx)) // 初手
+		}
+		return nil
+	}
+	if s.known == nil {
+		s.known = make(map[pos]bool)
+	}
+
+	// 地雷だけが確定した場合は、覚えた地雷を旗として解き直すと安全なマスが見つかることがある
+	var opens []Move
+	var guessed *Move
+	more := false // 解き直しの上限まで地雷が増え続けた
+	for round := 0; round < clickRounds && len(opens) == 0; round++ {
+		var moves []Move
+		s.onView(func() {
+			if guess {
+				moves = s.checkedStep(ctx)
+			} else {
+				moves = s.checkedCertainMoves(ctx)
+			}
+		})
+		if len(moves) > 0 && moves[0].Type == MoveUnflag {
+			return moves
+		}
+		if len(moves) == 1 && moves[0].IsGuess {
+			guessed = &moves[0]
+			break
+		}
+		learned := false
+		for _, m := range moves {
+			switch m.Type {
+			case MoveOpen:
+				opens = append(opens, m)
+			case MoveFlag:
+				if p := (pos{m.X, m.Y}); !s.known[p] {
+					s.known[p] = true
+					learned = true
+				}
+			}
+		}
+		more = learned && len(opens) == 0
+		if !learned {
+			break
+		}
+	}
+
+	if chord := s.bestChord(); chord != nil {
+		return chord
+	}
+	if len(opens) > 0 {
+		return opens[:1]
+	}
+	// 旗を立てることが勝利条件なら、最後は覚えた地雷に旗を立てる
+	if b.Rules.Win == game.WinFlagAll {
+		var mines []pos
+		for p := range s.known {
+			if !b.Cells[p.y][p.x].IsFlagged {
+				mines = append(mines, p)
+			}
+		}
+		sortPos(mines)
+		out := make([]Move, len(mines))
+		for i, p := range mines {
+			out[i] = Move{
+				X: p.x, Y: p.y, Type: MoveFlag, Strategy: StrategyChord, Confidence: 1.0,
+				Reason: "a known mine; every mine must be flagged to win",
+			}
+		}
+		if len(out) > 0 {
+			return out
+		}
+	}
+	if guessed != nil {
+		return []Move{*guessed}
+	}
+	if guess && more {
+		var move *Move
+		s.onView(func() { move = s.nextMove(ctx) })
+		return one(move)
+	}
+	return nil
+}
+
+// bestChord は得が最も大きい両押しを、先に立てる旗と合わせて返します (得が無ければ nil)
+// 周りの地雷が全て分かっている (旗か覚えた地雷) 数字マスだけを考えます
+func (s *Solver) bestChord() []Move {
+	b := s.Board
+	var best []Move
+	bestGain := 0
+	for y := 0; y < b.Height; y++ {
+		for x := 0; x < b.Width; x++ {
+			c := b.Cells[y][x]
+			if !c.IsRevealed || c.NeighborCount == 0 {
+				continue
+			}
+			flagged, opened := 0, 0
+			var need []pos
+			trusted := true
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if (dx == 0 && dy == 0) || !b.Contains(nx, ny) {
+						continue
+					}
+					n, p := b.Cells[ny][nx], pos{nx, ny}
+					switch {
+					case n.IsFlagged:
+						flagged++
+						trusted = trusted && (s.trusted[p] || s.known[p])
+					case n.IsRevealed:
+					case s.known[p]:
+						need = append(need, p)
+					default:
+						opened++
+					}
+				}
+			}
+			// 間違っているかもしれない旗の周りでは両押ししない
+			if !trusted || flagged+len(need) != c.NeighborCount || opened == 0 {
+				continue
+			}
+			gain := opened - len(need) - 1
+			if gain <= bestGain {
+				continue
+			}
+			bestGain = gain
+			best = best[:0]
+			for _, p := range need {
+				best = append(best, Move{
+					X: p.x, Y: p.y, Type: MoveFlag, Strategy: StrategyChord, Confidence: 1.0,
+					Reason:   fmt.Sprintf("a known mine, flagged so the %d at (%d,%d) can be chorded", c.NeighborCount, x, y),
+					Evidence: []Point{{x, y}},
+				})
+			}
+			best = append(best, Move{
+				X: x, Y: y, Type: MoveChord, Strategy: StrategyChord, Confidence: 1.0,
+				Reason: fmt.Sprintf("all %s around it are flagged, so one chord opens %s (saves %s)",
+					plural(c.NeighborCount, "mine"), plural(opened, "safe cell"), plural(gain, "click")),
+			})
+		}
+	}
+	return best
+}
+
+// nextClick は Efficient の NextMove です
+// 確定手はクリックの計画どおりに、推測は覚えた地雷を旗とみなした盤面でパイプラインに選ばせます
+func (s *Solver) nextClick(ctx context.Context) *Move {
+	if plan := s.clickPlan(ctx, true); len(plan) > 0 {
+		return &plan[0]
+	}
+	return nil
+}
+
+// onView は覚えた地雷に旗を立てた盤面の写しを s.Board にして f を実行します
+// 旗の無い地雷も、ロジックやタンクからは旗があるのと同じに見えます
+func (s *Solver) onView(f func()) {
+	real := s.Board
+	hidden := false
+	for p := range s.known {
+		if !real.Cells[p.y][p.x].IsFlagged {
+			hidden = true
+			break
+		}
+	}
+	if !hidden {
+		f()
+		return
+	}
+
+	view := real.Clone()
+	for p := range s.known {
+		view.Cells[p.y][p.x].IsFlagged = true
+	}
+	if s.trustedOn != real {
+		s.trusted = nil
+	}
+	// 覚えた地雷はソルバー自身が証明したものなので、旗として信用できる
+	if s.trusted == nil {
+		s.trusted = make(map[pos]bool)
+	}
+	for p := range s.known {
+		s.trusted[p] = true
+	}
+	s.Board, s.trustedOn = view, view
+	defer func() { s.Board, s.trustedOn = real, real }()
+	f()
+}
@@ -0,0 +1,40 @@
+package solver
+
+import (
+	"context"
+	"time"
+)
+
+// NextMoveContext は NextMove と同じですが、ctx が取り消されるか期限を過ぎると解析を打ち切ります
+// 打ち切られた段階はそれまでに分かった最善の手を返すか、次の (軽い) 段階に任せます
+// 時間切れの後に選んだ推測手は Approximate が true になります
+// 期限が切れてから始まる重い段階 (タンク / SAT / モンテカルロ) は何もせずに次へ進みます
+// ctx はソルバーに保存せず段階に引数で渡すので、入れ子の呼び出しでも外側の ctx は変わりません
+func (s *Solver) NextMoveContext(ctx context.Context) *Move {
+	var move *Move
+	if s.Efficient {
+		move = s.nextClick(ctx)
+	} else {
+		move = s.nextMove(ctx)
+	}
+	if move != nil && move.IsGuess && done(ctx) {
+		move.Approximate = true
+	}
+	return move
+}
+
+// done は ctx が取り消されたか期限を過ぎたかを返します (nil なら false)
+func done(ctx context.Context) bool {
+	return ctx != nil && ctx.Err() != nil
+}
+
+// stopAt は budget 後と ctx の期限のうち早い方の時刻を返します
+func stopAt(ctx context.Context, budget time.Duration) time.Time {
+	deadline := time.Now().Add(budget)
+	if ctx != nil {
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+	}
+	return deadline
+}
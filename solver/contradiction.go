@@ -0,0 +1,367 @@
+package solver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"minesweeper/game"
+)
+
+// Contradiction は数字と旗をどう組み合わせても満たせない (矛盾した) 盤面を表します
+// 数字は実際の盤面から出ているので正しく、原因は間違って立てた旗です
+type Contradiction struct {
+	Flags   []Point // 外すと矛盾が解ける旗の組 (どれか1本でも残すと矛盾する)
+	Minimum bool    // Flags が最小の本数だと確かめられた (false なら、より少ない組があるかもしれない)
+	Numbers []Point // その旗のせいで満たせなくなっている数字マス
+	Reason  string
+}
+
+// contradictionTrials は最小の旗の組を総当たりで探すときに試す組み合わせの数の上限
+const contradictionTrials = 2000
+
+// FindContradiction は盤面が矛盾していれば、原因になっている旗の組を返します (矛盾が無ければ nil)
+// 数字ごとの旗の数、各セグメントの解の有無、残り地雷数との整合性を調べます
+func (s *Solver) FindContradiction() *Contradiction {
+	return s.FindContradictionContext(context.Background())
+}
+
+// FindContradictionContext は FindContradiction と同じですが、ctx が終わると探索を打ち切ります
+// 探索全体で DefaultTankBudget までしか使いません。数えきれなかったセグメントは矛盾とみなしません
+func (s *Solver) FindContradictionContext(ctx context.Context) *Contradiction {
+	if s.Board == nil || !s.Board.IsInitialized {
+		return nil
+	}
+	ctx, cancel := context.WithDeadline(ctx, stopAt(ctx, DefaultTankBudget))
+	defer cancel()
+	if s.cache == nil {
+		s.cache = newSegCache()
+	}
+	// 旗を1本ずつ戻して数え直すとき、旗に触れていないセグメントの数え上げを使い回す
+	numbers, ok := conflicts(ctx, s.Board, s.cache)
+	if ok {
+		return nil
+	}
+
+	// ソルバーが証明した旗以外は、盤面のどこにあっても原因の候補にする
+	var candidates []pos
+	for y := 0; y < s.Board.Height; y++ {
+		for x := 0; x < s.Board.Width; x++ {
+			p := pos{x, y}
+			if s.Board.Cells[y][x].IsFlagged && !(s.trustedOn == s.Board && s.trusted[p]) {
+				candidates = append(candidates, p)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil // 旗が原因ではない (起こらないはず)
+	}
+
+	flags := irreducibleFlags(ctx, s.Board, s.cache, candidates, numbers)
+	if len(flags) == 0 {
+		return nil
+	}
+	flags, minimum := smallestFlags(ctx, s.Board, s.cache, candidates, flags)
+	c := &Contradiction{Flags: points(flags...), Minimum: minimum}
+
+	// 表示用に、外す旗に接していて矛盾していた数字を集める
+	original := numbers
+	near := map[pos]bool{}
+	for _, p := range flags {
+		for _, n := range original {
+			if abs(n.x-p.x) <= 1 && abs(n.y-p.y) <= 1 {
+				near[n] = true
+			}
+		}
+	}
+	var shown []pos
+	for _, n := range original {
+		if near[n] {
+			shown = append(shown, n)
+		}
+	}
+	if len(shown) == 0 {
+		shown = original
+	}
+	c.Numbers = points(shown...)
+
+	where := make([]string, len(flags))
+	for i, p := range flags {
+		where[i] = fmt.Sprintf("(%d,%d)", p.x, p.y)
+	}
+	switch {
+	case len(shown) > 0:
+		c.Reason = fmt.Sprintf("no mine layout fits %s with the current flags; removing the %s at %s resolves it",
+			plural(len(shown), "number"), pluralWord(len(flags), "flag"), strings.Join(where, ", "))
+	default:
+		c.Reason = fmt.Sprintf("%s on the board but only %s; removing the %s at %s resolves it",
+			plural(s.Board.GetFlagCount(), "flag"), plural(s.Board.MineCount, "mine"), pluralWord(len(flags), "flag"), strings.Join(where, ", "))
+	}
+	return c
+}
+
+// flagsTrusted は盤面の旗がすべて trusted に含まれるか (矛盾を調べなくてよいか) を返します
+// 正しい旗だけの盤面は実際の地雷配置が数字を満たすので、矛盾することはありません
+func (s *Solver) flagsTrusted() bool {
+	if s.trustedOn != s.Board {
+		s.trusted, s.trustedOn = nil, s.Board
+	}
+	for y := 0; y < s.Board.Height; y++ {
+		for x := 0; x < s.Board.Width; x++ {
+			if s.Board.Cells[y][x].IsFlagged && !s.trusted[pos{x, y}] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// trust は正しい旗だけの盤面から確定した旗を覚えます (それも正しい旗です)
+func (s *Solver) trust(moves ...Move) {
+	for _, m := range moves {
+		if m.Type != MoveFlag || m.IsGuess || m.Confidence != 1.0 {
+			continue
+		}
+		if s.trusted == nil {
+			s.trusted = make(map[pos]bool)
+		}
+		s.trusted[pos{m.X, m.Y}] = true
+	}
+}
+
+// Moves は矛盾を解くために旗を外す手を返します
+func (c *Contradiction) Moves() []Move {
+	moves := make([]Move, len(c.Flags))
+	for i, p := range c.Flags {
+		moves[i] = Move{
+			X: p.X, Y: p.Y,
+			Type:       MoveUnflag,
+			Strategy:   StrategyContradiction,
+			Confidence: 1.0,
+			Reason:     c.Reason,
+			Evidence:   c.Numbers,
+		}
+	}
+	return moves
+}
+
+// conflicts は盤面が矛盾していないかを調べ、満たせない数字マスを返します
+// ok が false で数字が空なら、残り地雷数 (旗の数) との矛盾です
+func conflicts(ctx context.Context, b *game.Board, cache *segCache) (numbers []pos, ok bool) {
+	ok = true
+
+	// 旗が多すぎる / 未開封マスが足りない数字
+	for y := 0; y < b.Height; y++ {
+		for x := 0; x < b.Width; x++ {
+			c := b.Cells[y][x]
+			if !c.IsRevealed || c.IsMine {
+				continue
+			}
+			flags, hidden := 0, 0
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if (dx == 0 && dy == 0) || !b.Contains(nx, ny) {
+						continue
+					}
+					if n := b.Cells[ny][nx]; n.IsFlagged {
+						flags++
+					} else if !n.IsRevealed {
+						hidden++
+					}
+				}
+			}
+			if flags > c.NeighborCount || flags+hidden < c.NeighborCount {
+				numbers = append(numbers, pos{x, y})
+				ok = false
+			}
+		}
+	}
+	if !ok {
+		return numbers, false
+	}
+
+	// 解の無いセグメント
+	ts := &TankSolver{Board: b, Context: ctx, cache: cache}
+	ts.deadline = stopAt(ctx, DefaultTankBudget)
+	segments := ts.createSegments()
+	counted := ts.countAll(segments)
+	minMines, maxMines, frontier := 0, 0, 0
+	for i, seg := range segments {
+		frontier += len(seg.unknowns)
+		sc := counted[i]
+		if !sc.ok {
+			maxMines += len(seg.unknowns) // 数えきれなかった場合は範囲を広く取る
+			continue
+		}
+		if sc.sr == nil {
+			for _, r := range seg.rules {
+				numbers = append(numbers, r.at)
+			}
+			ok = false
+			continue
+		}
+		lo, hi := -1, 0
+		for k, n := range sc.sr.counts {
+			if n > 0 {
+				if lo < 0 {
+					lo = k
+				}
+				hi = k
+			}
+		}
+		minMines += lo
+		maxMines += hi
+	}
+	if !ok {
+		sortPos(numbers)
+		return numbers, false
+	}
+
+	// 残り地雷数が境界と内側に収まらない
+	interior := 0
+	for y := 0; y < b.Height; y++ {
+		for x := 0; x < b.Width; x++ {
+			if c := b.Cells[y][x]; !c.IsRevealed && !c.IsFlagged && b.IsPlayable(x, y) {
+				interior++
+			}
+		}
+	}
+	interior -= frontier
+	remaining := b.MineCount - b.GetFlagCount()
+	if remaining < minMines || remaining > maxMines+interior {
+		return nil, false
+	}
+	return nil, true
+}
+
+// irreducibleFlags は candidates のうち、外すと矛盾が解けて、それ以上減らせない旗の組を返します
+// 候補を全部外した盤面から1本ずつ旗を戻し、戻しても矛盾しない旗は戻したままにします
+// 旗を増やすと解は減るだけなので、最後まで戻せなかった旗はどれを戻しても矛盾します
+// 矛盾している数字 (numbers) から遠い旗から戻すので、原因はなるべく矛盾の近くに絞られます
+// ctx が終わった場合は、まだ試していない旗も外したまま返します (矛盾は解けるが減らしきれていない)
+// どれを戻しても矛盾する組でも、本数が最小とは限りません (smallestFlags で確かめます)
+// 候補を全部外しても矛盾する場合は nil を返します
+func irreducibleFlags(ctx context.Context, b *game.Board, cache *segCache, candidates, numbers []pos) []pos {
+	board := b.Clone()
+	for _, p := range candidates {
+		board.Cells[p.y][p.x].IsFlagged = false
+	}
+	if _, ok := conflicts(ctx, board, cache); !ok || done(ctx) {
+		return nil
+	}
+
+	order := append([]pos(nil), candidates...)
+	dist := func(p pos) int {
+		d := b.Width + b.Height
+		for _, n := range numbers {
+			d = min(d, max(abs(n.x-p.x), abs(n.y-p.y)))
+		}
+		return d
+	}
+	sort.SliceStable(order, func(i, j int) bool { return dist(order[i]) > dist(order[j]) })
+
+	var removed []pos
+	for i, p := range order {
+		if done(ctx) {
+			removed = append(removed, order[i:]...)
+			break
+		}
+		board.Cells[p.y][p.x].IsFlagged = true
+		// 途中で打ち切られた数え上げは矛盾を見逃すので、戻せたとはみなさない
+		if _, ok := conflicts(ctx, board, cache); ok && !done(ctx) {
+			continue
+		}
+		board.Cells[p.y][p.x].IsFlagged = false
+		removed = append(removed, p)
+	}
+	sortPos(removed)
+	return removed
+}
+
+// smallestFlags は irreducible より少ない本数で矛盾が解ける組を、本数の少ない順に総当たりで探します
+// 見つかればその組を、無ければ irreducible を、どちらも minimum = true で返します
+// 試す組み合わせが contradictionTrials を超える場合や ctx が終わった場合は、
+// irreducible をそのまま minimum = false で返します
+func smallestFlags(ctx context.Context, b *game.Board, cache *segCache, candidates, irreducible []pos) (flags []pos, minimum bool) {
+	trials := 0
+	for k := 1; k < len(irreducible); k++ {
+		if trials += binomial(len(candidates), k, contradictionTrials+1); trials > contradictionTrials {
+			return irreducible, false
+		}
+	}
+	for k := 1; k < len(irreducible); k++ {
+		idx := make([]int, k)
+		for i := range idx {
+			idx[i] = i
+		}
+		for {
+			if done(ctx) {
+				return irreducible, false
+			}
+			board := b.Clone()
+			for _, i := range idx {
+				p := candidates[i]
+				board.Cells[p.y][p.x].IsFlagged = false
+			}
+			if _, ok := conflicts(ctx, board, cache); ok && !done(ctx) {
+				set := make([]pos, k)
+				for i, j := range idx {
+					set[i] = candidates[j]
+				}
+				sortPos(set)
+				return set, true
+			}
+			if !nextCombination(idx, len(candidates)) {
+				break
+			}
+		}
+	}
+	return irreducible, true
+}
+
+// binomial は n 個から k 個を選ぶ組み合わせの数を返します (limit を超えたら limit)
+func binomial(n, k, limit int) int {
+	c := 1
+	for i := 0; i < k; i++ {
+		c = c * (n - i) / (i + 1)
+		if c > limit {
+			return limit
+		}
+	}
+	return c
+}
+
+// nextCombination は idx を n 個から選ぶ次の組み合わせ (辞書順) に進めます
+func nextCombination(idx []int, n int) bool {
+	k := len(idx)
+	for i := k - 1; i >= 0; i-- {
+		if idx[i] < n-k+i {
+			idx[i]++
+			for j := i + 1; j < k; j++ {
+				idx[j] = idx[j-1] + 1
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// sortPos は座標を上の行から順に並べます
+func sortPos(ps []pos) {
+	sort.Slice(ps, func(i, j int) bool {
+		if ps[i].y != ps[j].y {
+			return ps[i].y < ps[j].y
+		}
+		return ps[i].x < ps[j].x
+	})
+}
+
+// pluralWord は数を付けずに単数形・複数形を選びます
+func pluralWord(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
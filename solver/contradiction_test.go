@@ -0,0 +1,43 @@
+package solver
+
+import (
+	"context"
+	"testing"
+
+	"minesweeper/game"
+)
+
+// TestFindContradictionSmallest は、1本ずつ旗を戻す方法では2本になるが、
+// 本当は1本外せば矛盾が解ける盤面で、最小の1本を返すことを確かめます
+//
+//	. . B . . . .   B, A, C は旗。X と Y は開いた 1
+//	. X . Y . . .   X の周りには A と B、Y の周りには B と C
+//	A . . . C . .   B を外せば両方の 1 が満たされる
+func TestFindContradictionSmallest(t *testing.T) {
+	b := game.NewBoard(7, 3, 3)
+	b.IsInitialized = true
+	for _, p := range []pos{{2, 0}, {0, 2}, {4, 2}} {
+		b.Cells[p.y][p.x].IsFlagged = true
+	}
+	for _, p := range []pos{{1, 1}, {3, 1}} {
+		b.Cells[p.y][p.x].IsRevealed = true
+		b.Cells[p.y][p.x].NeighborCount = 1
+	}
+
+	numbers, ok := conflicts(context.Background(), b, nil)
+	if ok {
+		t.Fatal("board should be contradictory")
+	}
+	candidates := []pos{{2, 0}, {0, 2}, {4, 2}}
+	if got := irreducibleFlags(context.Background(), b, nil, candidates, numbers); len(got) != 2 {
+		t.Fatalf("irreducible set = %v, want the two flags A and C (the case the exhaustive search must improve)", got)
+	}
+
+	c := NewWithPipeline(b, nil).FindContradiction()
+	if c == nil {
+		t.Fatal("no contradiction found")
+	}
+	if len(c.Flags) != 1 || c.Flags[0] != (Point{2, 0}) || !c.Minimum {
+		t.Errorf("flags = %v (minimum %v), want [(2,0)] (minimum true)", c.Flags, c.Minimum)
+	}
+}
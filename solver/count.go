@@ -0,0 +1,314 @@
+package solver
+
+import "time"
+
+// タンクの数え上げの既定の上限
+const (
+	DefaultStateLimit = 1 << 16         // 動的計画法の状態数の上限
+	DefaultTankBudget = 2 * time.Second // 1回の解析にかける時間の上限
+)
+
+// dpNode は「変数を i 個決めた時点での、途中の数字マスの地雷数」という状態
+type dpNode struct {
+	sums []byte    // 開いているルールごとの、ここまでの地雷数
+	fwd  []float64 // fwd[k] = ここまでに地雷を k 個置いてこの状態に至る方法の数
+	bwd  []float64 // bwd[k] = ここから残りに地雷を k 個置いて全制約を満たす方法の数
+	next [2]*dpNode
+}
+
+// countSegment はセグメントの解の数を、地雷数ごと・マスごとに数えます
+// 解を列挙せず、変数を順に決めながら「まだ閉じていない数字マスの地雷数」を状態とした
+// 動的計画法 (前向き・後ろ向きの2パス) で数えるので、境界が長くても状態数は幅にしか依存しません
+// 状態数か時間の上限を超えた場合は ok = false、解が無い場合は (nil, true) を返します
+func (ts *TankSolver) countSegment(seg *segment) (sr *segResult, ok bool) {
+	n := len(seg.unknowns)
+	fixed, consistent := propagate(seg)
+	if !consistent {
+		return nil, true
+	}
+
+	order := orderVariables(seg)
+	rank := make([]int, n)
+	for i, v := range order {
+		rank[v] = i
+	}
+
+	// 各ルールが最初/最後に現れる順位と、変数ごとの所属ルール
+	first := make([]int, len(seg.rules))
+	last := make([]int, len(seg.rules))
+	varRules := make([][]int, n)
+	remaining := make([]int, len(seg.rules))
+	for ri, r := range seg.rules {
+		first[ri], last[ri] = n, -1
+		for _, v := range r.cells {
+			if rank[v] < first[ri] {
+				first[ri] = rank[v]
+			}
+			if rank[v] > last[ri] {
+				last[ri] = rank[v]
+			}
+			varRules[v] = append(varRules[v], ri)
+		}
+		remaining[ri] = len(r.cells)
+	}
+
+	limit := ts.StateLimit
+	if limit <= 0 {
+		limit = DefaultStateLimit
+	}
+
+	// --- 前向きパス ---
+	layers := make([][]*dpNode, n+1)
+	layers[0] = []*dpNode{{fwd: []float64{1}, sums: []byte{}}}
+	active := []int{} // layers[i] の状態の sums が対応するルール (ルール番号順)
+	states := 1
+
+	for i, v := range order {
+		if ts.expired() {
+			return nil, false
+		}
+
+		contains := make([]bool, len(seg.rules))
+		for _, ri := range varRules[v] {
+			contains[ri] = true
+			remaining[ri]--
+		}
+		srcIdx := make([]int, len(seg.rules))
+		for ri := range srcIdx {
+			srcIdx[ri] = -1
+		}
+		for j, ri := range active {
+			srcIdx[ri] = j
+		}
+
+		// 決めた後も開いているルールと、ここで閉じるルール
+		var nextActive, closing []int
+		for ri := range seg.rules {
+			if first[ri] <= i && last[ri] > i {
+				nextActive = append(nextActive, ri)
+			} else if last[ri] == i {
+				closing = append(closing, ri)
+			}
+		}
+		st := &stepInfo{
+			seg: seg, srcIdx: srcIdx, contains: contains,
+			nextActive: nextActive, closing: closing, remaining: remaining,
+		}
+
+		index := make(map[string]*dpNode)
+		var layer []*dpNode
+		for _, node := range layers[i] {
+			for val := 0; val <= 1; val++ {
+				if fixed[v] >= 0 && int(fixed[v]) != val {
+					continue
+				}
+				sums, valid := st.apply(node.sums, val)
+				if !valid {
+					continue
+				}
+				child, exists := index[string(sums)]
+				if !exists {
+					child = &dpNode{fwd: make([]float64, i+2), sums: sums}
+					index[string(sums)] = child
+					layer = append(layer, child)
+					states++
+					if states > limit {
+						return nil, false
+					}
+				}
+				node.next[val] = child
+				for k, c := range node.fwd {
+					child.fwd[k+val] += c
+				}
+			}
+			node.sums = nil
+		}
+		if len(layer) == 0 {
+			return nil, true // 解なし
+		}
+		layers[i+1] = layer
+		active = nextActive
+	}
+
+	// --- 後ろ向きパスと周辺化 ---
+	sr = &segResult{
+		counts:   append([]float64(nil), layers[n][0].fwd...),
+		cellMine: make([][]float64, n),
+		cellSafe: make([][]float64, n),
+	}
+	layers[n][0].bwd = []float64{1}
+	for i := n - 1; i >= 0; i-- {
+		v := order[i]
+		mine := make([]float64, n+1)
+		safe := make([]float64, n+1)
+		for _, node := range layers[i] {
+			node.bwd = make([]float64, n-i+1)
+			for val := 0; val <= 1; val++ {
+				child := node.next[val]
+				if child == nil {
+					continue
+				}
+				out := safe
+				if val == 1 {
+					out = mine
+				}
+				for k, c := range child.bwd {
+					if c == 0 {
+						continue
+					}
+					node.bwd[k+val] += c
+					for j, f := range node.fwd {
+						out[j+k+val] += f * c
+					}
+				}
+			}
+		}
+		sr.cellMine[v] = mine
+		sr.cellSafe[v] = safe
+		// 使い終わった層は解放する
+		for _, node := range layers[i+1] {
+			node.bwd, node.fwd = nil, nil
+		}
+	}
+
+	sr.normalize()
+	return sr, true
+}
+
+// stepInfo は変数を1つ決めるときの状態遷移に必要な情報
+type stepInfo struct {
+	seg        *segment
+	srcIdx     []int  // ルール -> 遷移元の sums の位置 (-1 なら未登場)
+	contains   []bool // ルールが今決める変数を含むか
+	nextActive []int  // 遷移先の sums が対応するルール
+	closing    []int  // 今の変数が最後の変数になるルール
+	remaining  []int  // ルールごとの、まだ決めていない変数の数
+}
+
+// apply は変数に val を割り当てたときの遷移先の sums を返します
+// 閉じるルールの地雷数が合わない、または開いているルールが満たせなくなる場合は false
+func (st *stepInfo) apply(sums []byte, val int) ([]byte, bool) {
+	current := func(ri int) int {
+		c := 0
+		if j := st.srcIdx[ri]; j >= 0 {
+			c = int(sums[j])
+		}
+		if st.contains[ri] {
+			c += val
+		}
+		return c
+	}
+
+	for _, ri := range st.closing {
+		if current(ri) != st.seg.rules[ri].mines {
+			return nil, false
+		}
+	}
+	out := make([]byte, len(st.nextActive))
+	for j, ri := range st.nextActive {
+		c := current(ri)
+		m := st.seg.rules[ri].mines
+		// 地雷が多すぎる、または残りを全部地雷にしても足りない
+		if c > m || c+st.remaining[ri] < m {
+			return nil, false
+		}
+		out[j] = byte(c)
+	}
+	return out, true
+}
+
+// propagate は「残り0個」「残り全部地雷」の数字から確定する変数を伝播させます
+// fixed[i] は -1 (未確定), 0 (安全), 1 (地雷)。矛盾があれば false を返します
+func propagate(seg *segment) ([]int8, bool) {
+	fixed := make([]int8, len(seg.unknowns))
+	for i := range fixed {
+		fixed[i] = -1
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, r := range seg.rules {
+			open, mines := 0, 0
+			for _, v := range r.cells {
+				switch fixed[v] {
+				case -1:
+					open++
+				case 1:
+					mines++
+				}
+			}
+			need := r.mines - mines
+			if need < 0 || need > open {
+				return nil, false
+			}
+			if open == 0 || (need != 0 && need != open) {
+				continue
+			}
+			for _, v := range r.cells {
+				if fixed[v] == -1 {
+					if need == 0 {
+						fixed[v] = 0
+					} else {
+						fixed[v] = 1
+					}
+					changed = true
+				}
+			}
+		}
+	}
+	return fixed, true
+}
+
+// orderVariables は動的計画法の状態数 (同時に開いているルール数) が小さくなる順に変数を並べます
+// 「新しく開くルール数 - 閉じるルール数」が最小の変数を貪欲に選び、同点なら既に開いているルールに
+// 多く接している変数を優先します
+func orderVariables(seg *segment) []int {
+	n := len(seg.unknowns)
+	varRules := make([][]int, n)
+	left := make([]int, len(seg.rules))
+	for ri, r := range seg.rules {
+		for _, v := range r.cells {
+			varRules[v] = append(varRules[v], ri)
+		}
+		left[ri] = len(r.cells)
+	}
+
+	opened := make([]bool, len(seg.rules))
+	assigned := make([]bool, n)
+	order := make([]int, 0, n)
+	for len(order) < n {
+		best, bestScore, bestTouch := -1, 0, 0
+		for v := 0; v < n; v++ {
+			if assigned[v] {
+				continue
+			}
+			score, touch := 0, 0
+			for _, ri := range varRules[v] {
+				if !opened[ri] {
+					score++
+				} else {
+					touch++
+				}
+				if left[ri] == 1 {
+					score--
+				}
+			}
+			if best < 0 || score < bestScore || (score == bestScore && touch > bestTouch) {
+				best, bestScore, bestTouch = v, score, touch
+			}
+		}
+
+		assigned[best] = true
+		order = append(order, best)
+		for _, ri := range varRules[best] {
+			opened[ri] = true
+			left[ri]--
+		}
+	}
+	return order
+}
+
+// expired は解析の時間切れを判定します
+func (ts *TankSolver) expired() bool {
+	return (!ts.deadline.IsZero() && time.Now().After(ts.deadline)) || done(ts.Context)
+}
@@ -0,0 +1,158 @@
+package solver
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+	"testing"
+
+	"minesweeper/game"
+)
+
+// TestCountSegmentMatchesBruteForce は動的計画法の数え上げが、全ての地雷配置を1つずつ調べた結果と
+// 地雷数ごと・マスごとに一致することを確かめます
+// 小さい盤面は地雷の置き方を全て試し、大きい盤面は 18 マスを超える1つのセグメントで比べます
+func TestCountSegmentMatchesBruteForce(t *testing.T) {
+	// 5マスの未開封の列の、全ての地雷の置き方
+	for mask := 0; mask < 1<<5; mask++ {
+		row := []byte(".....")
+		for i := range row {
+			if mask&(1<<i) != 0 {
+				row[i] = '*'
+			}
+		}
+		b := parseBoard("ooooo", string(row), "ooooo")
+		compareCounts(t, fmt.Sprintf("row %s", row), b, 5)
+	}
+
+	// 開いた行で挟んだ未開封の2行 (真ん中の数字が両方の行を見るので1つのセグメントになる)
+	rng := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 5; trial++ {
+		rows := []string{"ooooooooooo", "", "ooooooooooo", "", "ooooooooooo"}
+		for _, y := range []int{1, 3} {
+			row := []byte("...........")
+			for i := range row {
+				if rng.Intn(10) < 3 {
+					row[i] = '*'
+				}
+			}
+			rows[y] = string(row)
+		}
+		compareCounts(t, fmt.Sprintf("trial %d", trial), parseBoard(rows...), 22)
+	}
+}
+
+// compareCounts は盤面の最大のセグメントを両方の方法で数えて比べます (セグメントは size マス以上)
+func compareCounts(t *testing.T, name string, b *game.Board, size int) {
+	t.Helper()
+	ts := NewTankSolver(b)
+	var seg *segment
+	for _, s := range ts.createSegments() {
+		if seg == nil || len(s.unknowns) > len(seg.unknowns) {
+			seg = s
+		}
+	}
+	if seg == nil || len(seg.unknowns) < size {
+		t.Fatalf("%s: no segment with %d cells", name, size)
+	}
+
+	sr, ok := ts.countSegment(seg)
+	if !ok || sr == nil {
+		t.Fatalf("%s: countSegment failed (ok = %v)", name, ok)
+	}
+	counts, mine, safe := bruteCount(seg)
+	scale := math.Exp(sr.logScale)
+	near := func(got, want float64) bool {
+		return math.Abs(got*scale-want) <= 1e-9*math.Max(want, 1)
+	}
+	for k, want := range counts {
+		if got := at(sr.counts, k); !near(got, want) {
+			t.Fatalf("%s: %g layouts with %d mines, want %g", name, got*scale, k, want)
+		}
+		for i := range seg.unknowns {
+			if got := at(sr.cellMine[i], k); !near(got, mine[i][k]) {
+				t.Fatalf("%s: cell %d is a mine in %g layouts with %d mines, want %g", name, i, got*scale, k, mine[i][k])
+			}
+			if got := at(sr.cellSafe[i], k); !near(got, safe[i][k]) {
+				t.Fatalf("%s: cell %d is safe in %g layouts with %d mines, want %g", name, i, got*scale, k, safe[i][k])
+			}
+		}
+	}
+}
+
+// bruteCount は 2^n 通りの配置を全て調べ、地雷数ごとの解の数と、マスごとの地雷/安全の数を返します
+func bruteCount(seg *segment) (counts []float64, mine, safe [][]float64) {
+	n := len(seg.unknowns)
+	masks := make([]uint64, len(seg.rules))
+	for ri, r := range seg.rules {
+		for _, c := range r.cells {
+			masks[ri] |= 1 << c
+		}
+	}
+	counts = make([]float64, n+1)
+	mine, safe = make([][]float64, n), make([][]float64, n)
+	for i := range mine {
+		mine[i], safe[i] = make([]float64, n+1), make([]float64, n+1)
+	}
+	for layout := uint64(0); layout < 1<<n; layout++ {
+		valid := true
+		for ri, m := range masks {
+			if bits.OnesCount64(layout&m) != seg.rules[ri].mines {
+				valid = false
+				break
+			}
+		}
+		if !valid {
+			continue
+		}
+		k := bits.OnesCount64(layout)
+		counts[k]++
+		for i := 0; i < n; i++ {
+			if layout&(1<<i) != 0 {
+				mine[i][k]++
+			} else {
+				safe[i][k]++
+			}
+		}
+	}
+	return counts, mine, safe
+}
+
+// at は範囲外なら 0 を返す添字アクセス
+func at(s []float64, k int) float64 {
+	if k < len(s) {
+		return s[k]
+	}
+	return 0
+}
+
+// TestConvolveAndLogChoose は地雷数分布の畳み込みと log C(n, k) を、直接計算した値と比べます
+func TestConvolveAndLogChoose(t *testing.T) {
+	// (1 + 2x)(3 + x + 4x²) = 3 + 7x + 6x² + 8x³
+	got := convolve([]float64{1, 2}, []float64{3, 1, 4})
+	want := []float64{3, 7, 6, 8}
+	if len(got) != len(want) {
+		t.Fatalf("convolve length %d, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("convolve[%d] = %g, want %g", i, got[i], want[i])
+		}
+	}
+
+	for n := 0; n <= 30; n++ {
+		c := 1.0 // C(n, k) をパスカルの規則で順に求める
+		for k := 0; k <= n; k++ {
+			if got := logChoose(n, k); math.Abs(got-math.Log(c)) > 1e-9*math.Max(1, math.Log(c)) {
+				t.Errorf("logChoose(%d, %d) = %g, want %g", n, k, got, math.Log(c))
+			}
+			c = c * float64(n-k) / float64(k+1)
+		}
+		for _, k := range []int{-1, n + 1} {
+			if got := logChoose(n, k); !math.IsInf(got, -1) {
+				t.Errorf("logChoose(%d, %d) = %g, want -Inf", n, k, got)
+			}
+		}
+	}
+}
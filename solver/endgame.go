@@ -0,0 +1,418 @@
+package solver
+
+import (
+	"context"
+	"fmt"
+	"math/bits"
+	"slices"
+	"sort"
+	"time"
+
+	"minesweeper/game"
+)
+
+const (
+	endgameCells   = 64                     // 探索する未開封マスの上限 (ビット集合に収まる数)
+	endgameLayouts = 400                    // 盤面と矛盾しない地雷配置の数の上限
+	endgameNodes   = 50000                  // 1回の探索で調べる局面数の上限
+	endgameBudget  = 300 * time.Millisecond // 1回の探索にかける時間の上限
+	endgameEps     = 1e-9                   // 勝率の比較で丸め誤差とみなす差
+)
+
+// endgame は終盤の全配置を列挙し、ゲーム木を最後まで探索して勝率を求めます
+// 未開封マスを 0..n-1 の番号で表し、地雷配置や開いたマスの集合は uint64 のビット集合で持ちます
+type endgame struct {
+	cells   []pos    // 未開封マス (境界が先、内側が後)
+	around  []uint64 // 各マスに隣接する未開封マスの集合
+	flagged []int    // 各マスに隣接する旗の数
+	mines   int      // 残り地雷数
+
+	memo     map[uint64][]memoEntry // key のハッシュ値ごとの探索済みの局面
+	nodes    int
+	deadline time.Time
+	aborted  bool
+}
+
+// findEndgameMove は残りの未開封マスと配置が少ない場合に、勝つ確率が最大になる推測マスを返します
+// その場で最も安全なマスが最善とは限りません (開けた後の数字で残りが決まるかどうかが違うため)
+// 確定して安全なマスがある、配置が多すぎる、時間内に探索しきれない場合は nil を返し、後の段階に任せます
+func (s *Solver) findEndgameMove(ctx context.Context) *Move {
+	b := s.Board
+	if !b.IsInitialized || done(ctx) {
+		return nil
+	}
+	// 勝ち負けでなく点数を競うルールでは、勝率を最大にしても意味がない
+	if b.Rules.Win == game.WinTimeAttack || b.Rules.Win == game.WinScoreAttack {
+		return nil
+	}
+
+	ts := NewTankSolver(b)
+	frontier, rules, interior := ts.flatten()
+	n := len(frontier) + len(interior)
+	if n == 0 || n > endgameCells {
+		return nil
+	}
+	eg := &endgame{
+		cells:    append(append([]pos{}, frontier...), interior...),
+		mines:    b.MineCount - b.GetFlagCount(),
+		memo:     make(map[uint64][]memoEntry),
+		deadline: stopAt(ctx, endgameBudget),
+	}
+	eg.neighbors(b)
+	layouts, ok := eg.layouts(len(frontier), rules)
+	if !ok || len(layouts) < 2 {
+		return nil
+	}
+
+	union := uint64(0)
+	for _, l := range layouts {
+		union |= l
+	}
+	if eg.all()&^union != 0 {
+		return nil // 確定して安全なマスがある (タンクが説明付きで返す)
+	}
+
+	best, win, safest, safestWin := eg.root(layouts, 0)
+	if eg.aborted || best < 0 {
+		return nil
+	}
+
+	p := eg.cells[best]
+	safe := eg.safeCount(layouts, best)
+	move := &Move{
+		X: p.x, Y: p.y,
+		Type:       MoveOpen,
+		Strategy:   StrategyEndgame,
+		Confidence: float64(safe) / float64(len(layouts)),
+		Reason: fmt.Sprintf("%.1f%% safe, and wins %.1f%% of the %d remaining layouts with best play",
+			float64(safe)/float64(len(layouts))*100, win*100, len(layouts)),
+	}
+	if safest != best {
+		move.Reason += fmt.Sprintf(" (the safest cell, %.1f%% safe, wins only %.1f%%)",
+			float64(eg.safeCount(layouts, safest))/float64(len(layouts))*100, safestWin*100)
+	}
+	if best < len(frontier) {
+		var numbers []pos
+		for _, r := range rules {
+			for _, c := range r.cells {
+				if c == best {
+					numbers = append(numbers, r.at)
+					break
+				}
+			}
+		}
+		move.Evidence = points(numbers...)
+	}
+	return move
+}
+
+// neighbors は各未開封マスの、隣接する未開封マスの集合と旗の数を求めます
+func (eg *endgame) neighbors(b *game.Board) {
+	index := make(map[pos]int, len(eg.cells))
+	for i, p := range eg.cells {
+		index[p] = i
+	}
+	eg.around = make([]uint64, len(eg.cells))
+	eg.flagged = make([]int, len(eg.cells))
+	for i, p := range eg.cells {
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				x, y := p.x+dx, p.y+dy
+				if (dx == 0 && dy == 0) || !b.Contains(x, y) {
+					continue
+				}
+				if b.Cells[y][x].IsFlagged {
+					eg.flagged[i]++
+				} else if j, ok := index[pos{x, y}]; ok {
+					eg.around[i] |= 1 << j
+				}
+			}
+		}
+	}
+}
+
+// layouts は数字と残り地雷数に矛盾しない全ての地雷配置を列挙します
+// 境界 (0..nf-1) は数字の制約で枝刈りしながら、内側は残りの地雷の組み合わせとして並べます
+// 配置が endgameLayouts を超える場合は ok = false を返します
+func (eg *endgame) layouts(nf int, rules []rule) (out []uint64, ok bool) {
+	n := len(eg.cells)
+	ni := n - nf
+	cellRules := make([][]int, nf)
+	for ri, r := range rules {
+		for _, c := range r.cells {
+			cellRules[c] = append(cellRules[c], ri)
+		}
+	}
+	placed := make([]int, len(rules)) // 各ルールで地雷にしたマスの数
+	open := make([]int, len(rules))   // 各ルールでまだ決めていないマスの数
+	for ri, r := range rules {
+		open[ri] = len(r.cells)
+	}
+
+	var interior func(l uint64, from, left int) bool
+	interior = func(l uint64, from, left int) bool {
+		if left == 0 {
+			out = append(out, l)
+			return len(out) <= endgameLayouts
+		}
+		for i := from; i <= n-left; i++ {
+			if !interior(l|1<<i, i+1, left-1) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var frontier func(i, mines int, l uint64) bool
+	frontier = func(i, mines int, l uint64) bool {
+		if eg.nodes++; eg.nodes > endgameNodes {
+			return false
+		}
+		if i == nf {
+			left := eg.mines - mines
+			if left < 0 || left > ni {
+				return true
+			}
+			return interior(l, nf, left)
+		}
+		for _, mine := range []bool{false, true} {
+			if mine && mines == eg.mines {
+				continue
+			}
+			fits := true
+			for _, ri := range cellRules[i] {
+				open[ri]--
+				if mine {
+					placed[ri]++
+				}
+				if placed[ri] > rules[ri].mines || placed[ri]+open[ri] < rules[ri].mines {
+					fits = false
+				}
+			}
+			cont := true
+			if fits {
+				next, m := l, mines
+				if mine {
+					next, m = l|1<<i, mines+1
+				}
+				cont = frontier(i+1, m, next)
+			}
+			for _, ri := range cellRules[i] {
+				open[ri]++
+				if mine {
+					placed[ri]--
+				}
+			}
+			if !cont {
+				return false
+			}
+		}
+		return true
+	}
+
+	if !frontier(0, 0, 0) {
+		return nil, false
+	}
+	eg.nodes = 0
+	return out, true
+}
+
+// root は最初の一手を全ての候補について探索し、勝率が最大のマスと勝率を返します
+// 比較のため、最も安全なマスとその勝率も返します
+func (eg *endgame) root(layouts []uint64, revealed uint64) (best int, win float64, safest int, safestWin float64) {
+	best, safest = -1, -1
+	for i, c := range eg.candidates(layouts, revealed) {
+		if float64(eg.safeCount(layouts, c))/float64(len(layouts)) <= win {
+			break
+		}
+		v := eg.open(layouts, revealed, c)
+		if eg.aborted {
+			return -1, 0, -1, 0
+		}
+		if i == 0 {
+			safest, safestWin = c, v
+		}
+		if best < 0 || v > win {
+			best, win = c, v
+		}
+	}
+	return best, win, safest, safestWin
+}
+
+// value は開いたマスの集合 revealed と、それに矛盾しない配置 layouts の局面の勝率です
+func (eg *endgame) value(layouts []uint64, revealed uint64) float64 {
+	hidden := len(eg.cells) - bits.OnesCount64(revealed)
+	if hidden == eg.mines {
+		return 1 // 残りは全て地雷
+	}
+	key := eg.key(layouts, revealed)
+	if v, ok := eg.lookup(key, layouts, revealed); ok {
+		return v
+	}
+	if eg.nodes++; eg.nodes > endgameNodes || (eg.nodes%256 == 0 && time.Now().After(eg.deadline)) {
+		eg.aborted = true
+		return 0
+	}
+
+	// 確定して安全なマスがあれば、それを開けるのが常に最善 (情報が増えるだけ)
+	union := uint64(0)
+	for _, l := range layouts {
+		union |= l
+	}
+	if safe := eg.all() &^ revealed &^ union; safe != 0 {
+		v := eg.open(layouts, revealed, bits.TrailingZeros64(safe))
+		eg.store(key, layouts, revealed, v)
+		return v
+	}
+
+	best := 0.0
+	for _, c := range eg.candidates(layouts, revealed) {
+		// 開けて生き残る確率が今の最善以下なら、それ以降の候補も勝てない
+		if float64(eg.safeCount(layouts, c))/float64(len(layouts)) <= best+endgameEps {
+			break
+		}
+		if v := eg.open(layouts, revealed, c); v > best {
+			best = v
+		}
+		if eg.aborted || best >= 1-endgameEps {
+			break
+		}
+	}
+	eg.store(key, layouts, revealed, best)
+	return best
+}
+
+// open はマス c を開けたときの勝率です
+// c が安全な配置を、開いて見える数字 (0 なら連鎖して開く範囲の数字も含む) ごとに分けて探索します
+func (eg *endgame) open(layouts []uint64, revealed uint64, c int) float64 {
+	type outcome struct {
+		revealed uint64
+		layouts  []uint64
+	}
+	groups := make(map[string]*outcome)
+	var order []string
+	for _, l := range layouts {
+		if l&(1<<c) != 0 {
+			continue
+		}
+		r, seen := eg.reveal(l, revealed, c)
+		g, ok := groups[seen]
+		if !ok {
+			g = &outcome{revealed: r}
+			groups[seen] = g
+			order = append(order, seen)
+		}
+		g.layouts = append(g.layouts, l)
+	}
+
+	win := 0.0
+	for _, seen := range order {
+		g := groups[seen]
+		win += float64(len(g.layouts)) / float64(len(layouts)) * eg.value(g.layouts, g.revealed)
+		if eg.aborted {
+			return 0
+		}
+	}
+	return win
+}
+
+// reveal は配置 l でマス c を開け、連鎖も含めて開いたマスの集合と、見えた数字の並びを返します
+// 数字の並びが同じ配置どうしは、開く範囲も同じになります (連鎖は数字だけで決まるため)
+func (eg *endgame) reveal(l, revealed uint64, c int) (uint64, string) {
+	var seen []byte
+	queue := []int{c}
+	revealed |= 1 << c
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		num := bits.OnesCount64(l&eg.around[i]) + eg.flagged[i]
+		seen = append(seen, byte(num))
+		if num != 0 {
+			continue
+		}
+		for next := eg.around[i] &^ revealed; next != 0; next &= next - 1 {
+			j := bits.TrailingZeros64(next)
+			revealed |= 1 << j
+			queue = append(queue, j)
+		}
+	}
+	return revealed, string(seen)
+}
+
+// candidates は開ける意味のあるマス (全ての配置で地雷のマスを除く) を、安全な配置の多い順に返します
+func (eg *endgame) candidates(layouts []uint64, revealed uint64) []int {
+	inter := ^uint64(0)
+	for _, l := range layouts {
+		inter &= l
+	}
+	var cells []int
+	for rest := eg.all() &^ revealed &^ inter; rest != 0; rest &= rest - 1 {
+		cells = append(cells, bits.TrailingZeros64(rest))
+	}
+	counts := make(map[int]int, len(cells))
+	for _, c := range cells {
+		counts[c] = eg.safeCount(layouts, c)
+	}
+	sort.SliceStable(cells, func(i, j int) bool { return counts[cells[i]] > counts[cells[j]] })
+	return cells
+}
+
+// safeCount はマス c が安全な配置の数を返します
+func (eg *endgame) safeCount(layouts []uint64, c int) int {
+	n := 0
+	for _, l := range layouts {
+		if l&(1<<c) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// all は全ての未開封マスの集合を返します
+func (eg *endgame) all() uint64 {
+	if len(eg.cells) == 64 {
+		return ^uint64(0)
+	}
+	return 1<<len(eg.cells) - 1
+}
+
+// memoEntry は探索済みの局面とその勝率です
+// ハッシュ値が衝突しても別の局面の値を使わないよう、局面そのものも覚えておきます
+type memoEntry struct {
+	revealed uint64
+	layouts  []uint64 // open が局面ごとに作るスライスで、後から書き換えられることはない
+	value    float64
+}
+
+// lookup は局面の勝率を探索済みなら返します
+func (eg *endgame) lookup(key uint64, layouts []uint64, revealed uint64) (float64, bool) {
+	for _, e := range eg.memo[key] {
+		if e.revealed == revealed && slices.Equal(e.layouts, layouts) {
+			return e.value, true
+		}
+	}
+	return 0, false
+}
+
+// store は局面の勝率を覚えます
+func (eg *endgame) store(key uint64, layouts []uint64, revealed uint64, v float64) {
+	eg.memo[key] = append(eg.memo[key], memoEntry{revealed: revealed, layouts: layouts, value: v})
+}
+
+// key は局面 (開いたマスと配置の集合) のハッシュ値 (FNV-1a) を返します
+// 配置は常に列挙した順のまま絞り込むので、同じ集合は同じ並びになります
+func (eg *endgame) key(layouts []uint64, revealed uint64) uint64 {
+	h := uint64(14695981039346656037)
+	mix := func(v uint64) {
+		for i := 0; i < 8; i++ {
+			h ^= v & 0xff
+			h *= 1099511628211
+			v >>= 8
+		}
+	}
+	mix(revealed)
+	for _, l := range layouts {
+		mix(l)
+	}
+	return h
+}
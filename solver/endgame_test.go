@@ -0,0 +1,81 @@
+package solver
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"minesweeper/game"
+)
+
+// TestEndgameKnownPositions は勝率を手で求められる終盤で、選ぶマスと勝率を確かめます
+func TestEndgameKnownPositions(t *testing.T) {
+	tests := []struct {
+		name  string
+		board *game.Board
+		moves []pos // 最善手 (どれでもよい)
+		win   float64
+	}{
+		{
+			// 上の 1 が2つとも下の2マスを見ているだけの 50/50。どちらを開けても半分しか勝てない
+			name:  "fifty-fifty",
+			board: parseBoard("oo", ".*"),
+			moves: []pos{{0, 1}, {1, 1}},
+			win:   0.5,
+		},
+		{
+			// 3マスに地雷1個。どのマスも 2/3 で安全だが、端を開けると出た数字で真ん中が分かり、
+			// 残りの2マスのどちらが地雷かも決まる。真ん中を開けると数字は必ず 1 で 50/50 が残る
+			name:  "revealing end cell",
+			board: parseBoard(".*."),
+			moves: []pos{{0, 0}, {2, 0}},
+			win:   2.0 / 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			best, win := searchEndgame(t, tt.board)
+			if math.Abs(win-tt.win) > endgameEps {
+				t.Errorf("win probability %.4f, want %.4f", win, tt.win)
+			}
+			found := false
+			for _, m := range tt.moves {
+				found = found || best == m
+			}
+			if !found {
+				t.Errorf("best move %v, want one of %v", best, tt.moves)
+			}
+
+			s := NewWithPipeline(tt.board, nil)
+			move := s.findEndgameMove(context.Background())
+			if move == nil {
+				t.Fatal("findEndgameMove returned no move")
+			}
+			if got := (pos{move.X, move.Y}); got != best {
+				t.Errorf("findEndgameMove chose %v, the search chose %v", got, best)
+			}
+		})
+	}
+}
+
+// searchEndgame は findEndgameMove と同じように盤面から探索を組み立て、最善手とその勝率を返します
+func searchEndgame(t *testing.T, b *game.Board) (pos, float64) {
+	t.Helper()
+	frontier, rules, interior := NewTankSolver(b).flatten()
+	eg := &endgame{
+		cells:    append(append([]pos{}, frontier...), interior...),
+		mines:    b.MineCount - b.GetFlagCount(),
+		memo:     make(map[uint64][]memoEntry),
+		deadline: stopAt(context.Background(), endgameBudget),
+	}
+	eg.neighbors(b)
+	layouts, ok := eg.layouts(len(frontier), rules)
+	if !ok {
+		t.Fatal("too many layouts")
+	}
+	best, win, _, _ := eg.root(layouts, 0)
+	if eg.aborted || best < 0 {
+		t.Fatal("search did not finish")
+	}
+	return eg.cells[best], win
+}
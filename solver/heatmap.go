@@ -0,0 +1,186 @@
+package solver
+
+import (
+	"context"
+
+	"minesweeper/game"
+)
+
+// CellKind は確率マップでのマスの種類
+type CellKind int
+
+const (
+	CellRevealed CellKind = iota // 開いたマス
+	CellFlagged                  // 旗 (確率は 1 として扱う)
+	CellFrontier                 // 数字に接している未開封マス
+	CellInterior                 // どの数字にも接していない未開封マス
+	CellVoid                     // 盤面の形で除外されたマス
+	CellUnsolved                 // 数字に接しているが、数えきれなかったセグメントの未開封マス (確率は概算)
+)
+
+// CellProbability は1マス分の地雷確率
+type CellProbability struct {
+	Kind    CellKind
+	Mine    float64 // 地雷確率 (開いたマスと存在しないマスは 0、旗は 1)
+	Certain bool    // 地雷確率が 0 か 1 と証明されている
+}
+
+// ProbabilityMap は盤面全体の地雷確率です (解析や学習用の表示に使います)
+type ProbabilityMap struct {
+	Width, Height int
+	Cells         [][]CellProbability // Cells[y][x]
+
+	Exact  bool   // 全て厳密に数えた確率 (false なら一部はモンテカルロの推定)
+	Method string // "Uniform" (初手前) / "Tank" / "MonteCarlo"
+}
+
+// Probabilities は全マスの地雷確率を返します (盤面は変えません)
+// 数えきれる場合はタンクの厳密な確率、境界が大きすぎる場合はモンテカルロの推定を使い、
+// 証明できる確定マスには Certain を付けます
+// 旗のせいで盤面が矛盾している場合は nil を返します (FindContradiction で原因を探せます)
+func (s *Solver) Probabilities() *ProbabilityMap {
+	return s.ProbabilitiesContext(context.Background())
+}
+
+// ProbabilitiesContext は Probabilities と同じですが、ctx が終わると解析を打ち切ります
+// 打ち切った場合は Exact が false になります
+func (s *Solver) ProbabilitiesContext(ctx context.Context) *ProbabilityMap {
+	b := s.Board
+	pm := &ProbabilityMap{Width: b.Width, Height: b.Height, Cells: make([][]CellProbability, b.Height), Exact: true}
+	hidden := 0
+	for y := range pm.Cells {
+		pm.Cells[y] = make([]CellProbability, b.Width)
+		for x := range pm.Cells[y] {
+			c := b.Cells[y][x]
+			switch {
+			case !b.IsPlayable(x, y):
+				pm.Cells[y][x].Kind = CellVoid
+			case c.IsRevealed:
+				pm.Cells[y][x].Kind = CellRevealed
+			case c.IsFlagged:
+				pm.Cells[y][x] = CellProbability{Kind: CellFlagged, Mine: 1}
+			default:
+				pm.Cells[y][x].Kind = CellInterior
+				hidden++
+			}
+		}
+	}
+
+	// 初手前は地雷が一様に置かれる
+	if !b.IsInitialized {
+		pm.Method = "Uniform"
+		if hidden > 0 {
+			pm.fillInterior(float64(b.MineCount)/float64(hidden), false)
+		}
+		return pm
+	}
+
+	ts := s.tankStage(ctx, BackendTank, false).(*TankSolver)
+	res := ts.analyze()
+	if res == nil {
+		return nil
+	}
+	pm.Method = "Tank"
+	for i, p := range res.frontier {
+		pm.Cells[p.y][p.x] = CellProbability{
+			Kind:    CellFrontier,
+			Mine:    res.probs[i],
+			Certain: res.mineWeight[i] == 0 || res.safeWeight[i] == 0,
+		}
+	}
+	if res.exact {
+		pm.fillInterior(res.interiorProb, res.interiorMine == 0 || res.interiorSafe == 0)
+		return pm
+	}
+
+	// 数えきれなかったセグメントがある: 確率はモンテカルロで推定し、
+	// 数えきれたセグメント単独で確定するマスだけ確定として残す
+	// 数えきれなかったセグメントのマスは内側と区別して CellUnsolved にする (推定できれば境界に戻す)
+	pm.Exact = false
+	pm.markUnsolved(b)
+	mc := NewMonteCarloSolver(b)
+	mc.Samples = s.SampleBudget
+	mc.Rand = s.rng()
+	mc.Context = ctx
+	est := mc.estimate()
+	if est == nil {
+		// 推定もできなければ、残り地雷数を未確定のマスに均等に割り振る
+		left, cells := b.MineCount-b.GetFlagCount(), 0
+		for y := range pm.Cells {
+			for x := range pm.Cells[y] {
+				cp := pm.Cells[y][x]
+				if cp.Certain && cp.Mine == 1 {
+					left--
+				}
+				if cp.hidden() && !cp.Certain {
+					cells++
+				}
+			}
+		}
+		if cells > 0 {
+			pm.fillUncertain(max(0, min(1, float64(left)/float64(cells))))
+		}
+		return pm
+	}
+	pm.Method = "MonteCarlo"
+	for i, p := range est.frontier {
+		cp := &pm.Cells[p.y][p.x]
+		cp.Kind = CellFrontier
+		if !cp.Certain {
+			cp.Mine = est.probs[i]
+		}
+	}
+	pm.fillInterior(est.interiorProb, false)
+	return pm
+}
+
+// fillUncertain は確定していない未開封マスすべてに同じ確率を入れます
+func (pm *ProbabilityMap) fillUncertain(prob float64) {
+	for y := range pm.Cells {
+		for x := range pm.Cells[y] {
+			if cp := &pm.Cells[y][x]; cp.hidden() && !cp.Certain {
+				cp.Mine = prob
+			}
+		}
+	}
+}
+
+// fillInterior は内側 (どの数字にも接していない未開封マス) に同じ確率を入れます
+func (pm *ProbabilityMap) fillInterior(prob float64, certain bool) {
+	for y := range pm.Cells {
+		for x := range pm.Cells[y] {
+			if cp := &pm.Cells[y][x]; cp.Kind == CellInterior {
+				cp.Mine, cp.Certain = prob, certain
+			}
+		}
+	}
+}
+
+// markUnsolved は内側として扱われた未開封マスのうち、開いたマスに接するもの
+// (数えきれなかったセグメントのマス) を CellUnsolved にします
+func (pm *ProbabilityMap) markUnsolved(b *game.Board) {
+	for y := range pm.Cells {
+		for x := range pm.Cells[y] {
+			if pm.Cells[y][x].Kind == CellInterior && revealedNeighbor(b, x, y) {
+				pm.Cells[y][x].Kind = CellUnsolved
+			}
+		}
+	}
+}
+
+// revealedNeighbor は (x, y) の周りに開いた安全マス (数字) があるかを返します
+func revealedNeighbor(b *game.Board, x, y int) bool {
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			if (dx != 0 || dy != 0) && b.Contains(x+dx, y+dy) && b.Cells[y+dy][x+dx].IsRevealed && !b.Cells[y+dy][x+dx].IsMine {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hidden は旗の無い未開封マスかどうかを返します
+func (cp CellProbability) hidden() bool {
+	return cp.Kind == CellFrontier || cp.Kind == CellInterior || cp.Kind == CellUnsolved
+}
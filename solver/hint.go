@@ -0,0 +1,182 @@
+package solver
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// HintLevel はヒントで明かす情報の段階です
+type HintLevel int
+
+const (
+	HintRegion    HintLevel = iota + 1 // 確定手がある範囲だけを示す
+	HintTechnique                      // 範囲と、使う手法の名前を示す
+	HintMove                           // 手そのものと理由を示す
+)
+
+// Rect は盤面上の長方形の範囲
+type Rect struct {
+	X, Y          int
+	Width, Height int
+}
+
+// Hint は人間のプレイヤー向けのヒントです
+// Level が低いほど答えを明かさず、考える余地を残します
+type Hint struct {
+	Level     HintLevel
+	Guess     bool   // 確定手が無く、推測するしかない
+	Region    *Rect  // 手が見つかる範囲 (推測の場合は nil)
+	Technique string // 手法の名前 (HintTechnique 以上)
+	Move      *Move  // 手と理由 (HintMove のみ)
+	Message   string // そのまま表示できる文
+}
+
+// techniques は段階 (Move.Strategy) ごとの、人に伝える手法の名前
+var techniques = map[StrategyID]string{
+	StrategyLogic:         "single-number counting",
+	StrategyAdvanced:      "comparing two overlapping numbers",
+	StrategyLinear:        "combining several numbers (linear algebra)",
+	StrategyTank:          "checking every possible mine layout",
+	StrategySAT:           "checking every possible mine layout",
+	StrategyContradiction: "finding a contradiction with your flags",
+	StrategyChord:         "chording a number whose mines are all known",
+}
+
+// Hint は level に応じたヒントを返します (盤面は変えません)
+func (s *Solver) Hint(level HintLevel) *Hint {
+	return s.HintContext(context.Background(), level)
+}
+
+// HintContext は Hint と同じですが、ctx が終わると解析を打ち切ります
+// 手が無い (初手前や終局) 場合は nil を返します
+// 段階 1, 2 は確定手があるかどうかだけを調べ、推測の段階 (モンテカルロや終盤探索) は動かしません
+// ヒントの回数は数えないので、呼び出し側で Stats.Hint に記録してください
+func (s *Solver) HintContext(ctx context.Context, level HintLevel) *Hint {
+	if level < HintRegion {
+		level = HintRegion
+	}
+	if level > HintMove {
+		level = HintMove
+	}
+	if !s.Board.IsInitialized {
+		return nil
+	}
+	var move *Move
+	if level >= HintMove {
+		// 推測手も示すので、確定手が無ければ同じ解析から推測手を選ぶ
+		if moves := s.StepContext(ctx); len(moves) > 0 {
+			move = &moves[0]
+		}
+	} else if moves := s.CertainMovesContext(ctx); len(moves) > 0 {
+		move = &moves[0]
+	} else if !s.Board.IsFinished() {
+		move = &Move{IsGuess: true} // どこを推測するかは示さないので選ばない
+	}
+	if move == nil {
+		return nil
+	}
+
+	h := &Hint{Level: level, Guess: move.IsGuess}
+	if level >= HintMove {
+		h.Move = move
+	}
+	if h.Guess {
+		h.Technique = "guessing"
+		h.Message = "There is no certain move; you have to guess."
+		if level >= HintMove {
+			h.Message = fmt.Sprintf("Guess (%d,%d): %s", move.X, move.Y, move.Reason)
+		}
+		return h
+	}
+
+	h.Region = s.hintRegion(move)
+	h.Technique = techniques[move.Strategy]
+	if h.Technique == "" {
+		h.Technique = move.Strategy.String()
+	}
+	switch level {
+	case HintRegion:
+		h.Technique = ""
+		h.Message = "There is a certain move in the highlighted area."
+	case HintTechnique:
+		h.Message = fmt.Sprintf("There is a certain move in the highlighted area, found by %s.", h.Technique)
+	default:
+		action := "Open"
+		switch move.Type {
+		case MoveFlag:
+			action = "Flag"
+		case MoveUnflag:
+			action = "Remove the flag at"
+		case MoveChord:
+			action = "Chord"
+		}
+		h.Message = fmt.Sprintf("%s (%d,%d): %s", action, move.X, move.Y, move.Reason)
+	}
+	return h
+}
+
+// hintRegionCells は段階 1, 2 のヒントの範囲に最低限含める未開封マスの数
+// 範囲の中で開けられるマスが1つしか無いと、範囲だけで答えが分かってしまう
+const hintRegionCells = 3
+
+// hintRegion は手の対象と根拠のマスを囲み、1マス広げた範囲を返します
+// 根拠が無い手 (対象のマスを中心にした 3x3 になってしまう) は、対象を含む境界のセグメント全体を囲みます
+// さらに範囲の中の未開封マスが hintRegionCells 個に満たなければ、満たすまで全方向に広げます
+func (s *Solver) hintRegion(move *Move) *Rect {
+	x0, y0, x1, y1 := move.X, move.Y, move.X, move.Y
+	include := func(x, y int) {
+		x0, y0 = min(x0, x), min(y0, y)
+		x1, y1 = max(x1, x), max(y1, y)
+	}
+	for _, p := range move.Evidence {
+		include(p.X, p.Y)
+	}
+	if len(move.Evidence) == 0 {
+		for _, p := range s.segmentAround(pos{move.X, move.Y}) {
+			include(p.x, p.y)
+		}
+	}
+
+	w, h := s.Board.Width, s.Board.Height
+	for margin := 1; ; margin++ {
+		r := &Rect{X: max(x0-margin, 0), Y: max(y0-margin, 0)}
+		r.Width = min(x1+margin, w-1) - r.X + 1
+		r.Height = min(y1+margin, h-1) - r.Y + 1
+		if s.hiddenIn(r) >= hintRegionCells || (r.Width == w && r.Height == h) {
+			return r
+		}
+	}
+}
+
+// segmentAround は p を未開封マスか数字マスとして含むセグメントの、全ての未開封マスと数字マスを返します
+func (s *Solver) segmentAround(p pos) []pos {
+	var cells []pos
+	for _, seg := range NewTankSolver(s.Board).createSegments() {
+		found := slices.Contains(seg.unknowns, p)
+		for _, r := range seg.rules {
+			found = found || r.at == p
+		}
+		if !found {
+			continue
+		}
+		cells = append(cells, seg.unknowns...)
+		for _, r := range seg.rules {
+			cells = append(cells, r.at)
+		}
+	}
+	return cells
+}
+
+// hiddenIn は範囲の中の、旗の無い未開封マスの数を返します
+func (s *Solver) hiddenIn(r *Rect) int {
+	n := 0
+	for y := r.Y; y < r.Y+r.Height; y++ {
+		for x := r.X; x < r.X+r.Width; x++ {
+			if c := s.Board.Cells[y][x]; s.Board.IsPlayable(x, y) && !c.IsRevealed && !c.IsFlagged {
+				n++
+			}
+		}
+	}
+	return n
+}
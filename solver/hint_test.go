@@ -0,0 +1,69 @@
+package solver
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"minesweeper/game"
+)
+
+// TestHintRegionHidesTarget は段階 1 のヒントの範囲が手の対象を含み、
+// 範囲の中に開けられそうなマスが他にもあって答えを特定できないことを確かめます
+func TestHintRegionHidesTarget(t *testing.T) {
+	// 根拠の無い手を対象の周り 3x3 で囲むと、未開封マスが対象しか無くなる盤面
+	b := parseBoard(
+		"ooooo",
+		"ooooo",
+		"oo.oo",
+		"ooooo",
+		"*.*..",
+	)
+	b.MineCount = 2
+	s := NewWithPipeline(b, nil)
+	checkRegion(t, "hand-built", s, &Move{X: 2, Y: 2, Type: MoveOpen}, s.hintRegion(&Move{X: 2, Y: 2, Type: MoveOpen}))
+
+	positions := 0
+	for g := 0; g < 10; g++ {
+		seed := int64(g)
+		rng := rand.New(rand.NewSource(seed))
+		b := game.NewBoard(16, 16, 40)
+		b.Rand = rand.New(rand.NewSource(seed))
+		b.Open(8, 8)
+		s := New(b, ModeHybrid)
+		for step := 0; !b.IsFinished(); step++ {
+			if moves := s.CertainMoves(); len(moves) > 0 {
+				name := fmt.Sprintf("seed %d step %d", seed, step)
+				h := s.Hint(HintRegion)
+				if h == nil || h.Region == nil {
+					t.Fatalf("%s: no region for a certain move", name)
+				}
+				checkRegion(t, name, s, &moves[0], h.Region)
+				// 根拠を伏せても同じ
+				bare := moves[0]
+				bare.Evidence = nil
+				checkRegion(t, name+" without evidence", s, &bare, s.hintRegion(&bare))
+				positions++
+			}
+			if !advance(b, rng) {
+				break
+			}
+		}
+	}
+	if positions < 50 {
+		t.Fatalf("only %d positions were checked", positions)
+	}
+}
+
+// checkRegion は範囲が手の対象を含み、未開封マスを hintRegionCells 個以上含むか
+// (盤面にそれだけ残っていなければ盤面全体か) を確かめます
+func checkRegion(t *testing.T, name string, s *Solver, move *Move, r *Rect) {
+	t.Helper()
+	if move.X < r.X || move.X >= r.X+r.Width || move.Y < r.Y || move.Y >= r.Y+r.Height {
+		t.Fatalf("%s: region %+v does not contain the move at (%d,%d)", name, *r, move.X, move.Y)
+	}
+	whole := &Rect{Width: s.Board.Width, Height: s.Board.Height}
+	if n := s.hiddenIn(r); n < hintRegionCells && *r != *whole {
+		t.Fatalf("%s: region %+v has only %d hidden cells", name, *r, n)
+	}
+}
@@ -0,0 +1,204 @@
+package solver
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+const linearEps = 1e-9
+
+// findLinearMove は数字マスを「周囲の未開封マスの地雷数の和 = 残り地雷数」という
+// 連立一次方程式とみなして掃き出し法で簡約し、各変数が 0/1 であることを使って確定マスを探します
+// 2つの数字の包含関係だけを見る findAdvancedMove より広く、タンクの全探索より軽い段階です
+func (s *Solver) findLinearMove(ctx context.Context) *Move {
+	ms := newMoveSet(1)
+	s.linearMoves(ctx, ms)
+	return ms.first()
+}
+
+// linearMoves は簡約後の全ての行から確定するマスを集めます
+// ctx が終わると簡約を途中でやめます。途中の行も元の式の組み合わせなので、見つかる確定手は正しいままです
+func (s *Solver) linearMoves(ctx context.Context, ms *moveSet) {
+	vars := []pos{}
+	index := make(map[pos]int)
+	varOf := func(p pos) int {
+		i, ok := index[p]
+		if !ok {
+			i = len(vars)
+			index[p] = i
+			vars = append(vars, p)
+		}
+		return i
+	}
+
+	type equation struct {
+		cells []int
+		mines int
+		at    pos // 元の数字マス (全体の式なら使わない)
+	}
+	equations := []equation{}
+	for y := 0; y < s.Board.Height; y++ {
+		for x := 0; x < s.Board.Width; x++ {
+			cell := s.Board.Cells[y][x]
+			if !cell.IsRevealed || cell.IsMine {
+				continue
+			}
+			_, flags, hidden := s.getNeighborsInfo(x, y)
+			if len(hidden) == 0 {
+				continue
+			}
+			eq := equation{mines: cell.NeighborCount - flags, at: pos{x, y}}
+			for _, p := range hidden {
+				eq.cells = append(eq.cells, varOf(p))
+			}
+			equations = append(equations, eq)
+		}
+	}
+	if len(equations) == 0 {
+		return
+	}
+
+	// 盤面全体の残り地雷数も1本の式として加える (終盤で効く)
+	global := equation{mines: s.Board.MineCount - s.Board.GetFlagCount()}
+	for y := 0; y < s.Board.Height; y++ {
+		for x := 0; x < s.Board.Width; x++ {
+			c := s.Board.Cells[y][x]
+			if !c.IsRevealed && !c.IsFlagged && s.Board.IsPlayable(x, y) {
+				global.cells = append(global.cells, varOf(pos{x, y}))
+			}
+		}
+	}
+	equations = append(equations, global)
+
+	// 拡大係数行列 (n 列目が右辺)
+	// 右辺の後ろに単位行列を付けておくと、簡約後の各行がどの式の組み合わせかが残る
+	n := len(vars)
+	matrix := make([][]float64, len(equations))
+	for r, eq := range equations {
+		matrix[r] = make([]float64, n+1+len(equations))
+		for _, i := range eq.cells {
+			matrix[r][i] = 1
+		}
+		matrix[r][n] = float64(eq.mines)
+		matrix[r][n+1+r] = 1
+	}
+	reduce(ctx, matrix, n)
+
+	for _, row := range matrix {
+		moves := s.linearDeduction(row, vars)
+		if len(moves) == 0 {
+			continue
+		}
+		var evidence []Point
+		usesGlobal := false
+		for r, eq := range equations {
+			if math.Abs(row[n+1+r]) < linearEps {
+				continue
+			}
+			if r == len(equations)-1 {
+				usesGlobal = true
+			} else {
+				evidence = append(evidence, Point{eq.at.x, eq.at.y})
+			}
+		}
+		reason := fmt.Sprintf("a linear combination of %s fixes this cell", plural(len(evidence), "number"))
+		if usesGlobal {
+			reason += " (with the remaining mine count)"
+		}
+		for _, move := range moves {
+			move.Reason, move.Evidence = reason, evidence
+			if ms.add(move) {
+				return
+			}
+		}
+	}
+}
+
+// linearDeduction は簡約後の1行から確定するマスを返します (安全マスが先)
+// 係数が正の変数を全て 1、負の変数を全て 0 にしてやっと右辺に届くなら、その割り当てしかありません
+// (逆に最小値と右辺が一致する場合も同様)
+func (s *Solver) linearDeduction(row []float64, vars []pos) []Move {
+	n := len(vars)
+	minSum, maxSum := 0.0, 0.0
+	nonZero := false
+	for i := 0; i < n; i++ {
+		a := row[i]
+		if math.Abs(a) < linearEps {
+			continue
+		}
+		nonZero = true
+		if a > 0 {
+			maxSum += a
+		} else {
+			minSum += a
+		}
+	}
+	if !nonZero {
+		return nil
+	}
+
+	b := row[n]
+	atMax := math.Abs(b-maxSum) < linearEps
+	atMin := math.Abs(b-minSum) < linearEps
+	if !atMax && !atMin {
+		return nil
+	}
+
+	// 安全マスを優先して返す
+	var safe, flags []Move
+	for i := 0; i < n; i++ {
+		a := row[i]
+		if math.Abs(a) < linearEps {
+			continue
+		}
+		isMine := (a > 0) == atMax
+		p := vars[i]
+		if !isMine {
+			safe = append(safe, Move{X: p.x, Y: p.y, Type: MoveOpen})
+		} else if !s.Board.Cells[p.y][p.x].IsFlagged {
+			flags = append(flags, Move{X: p.x, Y: p.y, Type: MoveFlag})
+		}
+	}
+	return append(safe, flags...)
+}
+
+// reduce は拡大係数行列を行既約階段形に変形します (部分ピボット選択付き)
+// ピボットは先頭 cols 列から選び、行の操作は右辺より後ろの列にも同じように行います
+// ctx が終わったら、その列までで変形をやめます
+func reduce(ctx context.Context, matrix [][]float64, cols int) {
+	row := 0
+	for col := 0; col < cols && row < len(matrix); col++ {
+		if col%16 == 0 && done(ctx) {
+			return
+		}
+		pivot := row
+		for r := row + 1; r < len(matrix); r++ {
+			if math.Abs(matrix[r][col]) > math.Abs(matrix[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(matrix[pivot][col]) < linearEps {
+			continue
+		}
+		matrix[row], matrix[pivot] = matrix[pivot], matrix[row]
+
+		p := matrix[row][col]
+		for c := col; c < len(matrix[row]); c++ {
+			matrix[row][c] /= p
+		}
+		for r := range matrix {
+			if r == row {
+				continue
+			}
+			f := matrix[r][col]
+			if math.Abs(f) < linearEps {
+				continue
+			}
+			for c := col; c < len(matrix[r]); c++ {
+				matrix[r][c] -= f * matrix[row][c]
+			}
+		}
+		row++
+	}
+}
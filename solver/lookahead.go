@@ -0,0 +1,186 @@
+package solver
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	lookaheadCandidates = 8   // 先読みで詳しく調べる候補の数
+	lookaheadMargin     = 0.9 // 最も安全なマスの安全率のこの割合以上の候補だけを調べる
+	lookaheadInterior   = 2   // 内側のマスから候補に加える数 (角寄り・境界寄りそれぞれ)
+)
+
+// guessEval は推測候補1つの評価結果
+type guessEval struct {
+	p        pos
+	prob     float64 // 地雷確率
+	progress float64 // 安全だった場合に、次に確定手が見つかる確率
+	info     float64 // 安全だった場合に確定する安全マス数の期待値
+	approx   bool    // 時間切れで先読みを打ち切った
+}
+
+// score は「生き残る確率 × 次に進める確率」
+func (e guessEval) score() float64 {
+	return (1 - e.prob) * e.progress
+}
+
+// lookaheadGuess は地雷確率だけでなく、開けた後に出る数字ごとの展開まで見て推測マスを選びます
+// 各候補について出うる数字 n を仮定した盤面を解き、n が出る確率 (解の数の比) と
+// その盤面で確定する安全マスの数から「生き残って、かつ次に進める確率」が最大のマスを返します
+func (ts *TankSolver) lookaheadGuess(res *tankResult) (guessEval, bool) {
+	candidates := ts.guessCandidates(res)
+	if len(candidates) == 0 {
+		return guessEval{}, false
+	}
+
+	var best *guessEval
+	for i := range candidates {
+		c := &candidates[i]
+		if !ts.evaluateGuess(c) {
+			// 時間切れなら確率だけで選ぶ
+			e, ok := ts.bestGuess(res)
+			e.approx = true
+			return e, ok
+		}
+		if best == nil || betterGuess(*c, *best) {
+			best = c
+		}
+	}
+	return *best, true
+}
+
+// betterGuess は a が b より良い推測かどうかを返します
+func betterGuess(a, b guessEval) bool {
+	if math.Abs(a.score()-b.score()) > linearEps {
+		return a.score() > b.score()
+	}
+	if math.Abs(a.prob-b.prob) > linearEps {
+		return a.prob < b.prob
+	}
+	return a.info > b.info
+}
+
+// guessCandidates は先読みする候補を、地雷確率の低い順に選びます
+func (ts *TankSolver) guessCandidates(res *tankResult) []guessEval {
+	safest, ok := ts.bestGuess(res)
+	if !ok {
+		return nil
+	}
+	threshold := 1 - (1-safest.prob)*lookaheadMargin
+
+	candidates := []guessEval{}
+	frontier := make(map[pos]bool, len(res.frontier))
+	for i, p := range res.frontier {
+		frontier[p] = true
+		if res.probs[i] <= threshold+linearEps {
+			candidates = append(candidates, guessEval{p: p, prob: res.probs[i]})
+		}
+	}
+
+	// 内側のマスは確率が全て同じなので、角に近いものと境界に接するものを代表として加える
+	if len(res.interior) > 0 && res.interiorProb <= threshold+linearEps {
+		interior := append([]pos(nil), res.interior...)
+		sort.SliceStable(interior, func(i, j int) bool {
+			return neighborCount(ts.Board, interior[i]) < neighborCount(ts.Board, interior[j])
+		})
+		added := make(map[pos]bool)
+		for _, p := range interior[:min(lookaheadInterior, len(interior))] {
+			added[p] = true
+		}
+		near := 0
+		for _, p := range interior {
+			if near >= lookaheadInterior {
+				break
+			}
+			if !added[p] && ts.touches(p, frontier) {
+				added[p] = true
+				near++
+			}
+		}
+		for _, p := range interior {
+			if added[p] {
+				candidates = append(candidates, guessEval{p: p, prob: res.interiorProb})
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].prob < candidates[j].prob })
+	if len(candidates) > lookaheadCandidates {
+		candidates = candidates[:lookaheadCandidates]
+	}
+	return candidates
+}
+
+// evaluateGuess はマスを開けて数字 n (0〜8) が出た盤面をそれぞれ解き、e の progress と info を埋めます
+// 時間切れの場合は false を返します
+func (ts *TankSolver) evaluateGuess(e *guessEval) bool {
+	logs := []float64{}
+	resolved := []int{}
+	for n := 0; n <= 8; n++ {
+		left := time.Until(ts.deadline)
+		if left <= 0 || done(ts.Context) {
+			return false
+		}
+
+		b := ts.Board.Clone()
+		c := &b.Cells[e.p.y][e.p.x]
+		c.IsRevealed, c.IsMine, c.NeighborCount = true, false, n
+
+		sub := &TankSolver{Board: b, StateLimit: ts.StateLimit, Budget: left, Workers: ts.Workers, Context: ts.Context, cache: ts.cache}
+		r := sub.analyze()
+		if r == nil {
+			continue // この数字は出ない
+		}
+		logs = append(logs, r.logZ)
+		resolved = append(resolved, r.safeCount())
+	}
+	if len(logs) == 0 {
+		return true
+	}
+
+	// 数字 n が出る確率は、その盤面と矛盾しない配置の数に比例する
+	maxLog := math.Inf(-1)
+	for _, l := range logs {
+		maxLog = math.Max(maxLog, l)
+	}
+	total := 0.0
+	for i, l := range logs {
+		w := math.Exp(l - maxLog)
+		total += w
+		if resolved[i] > 0 {
+			e.progress += w
+		}
+		e.info += w * float64(resolved[i])
+	}
+	e.progress /= total
+	e.info /= total
+	return true
+}
+
+// safeCount は確定した安全マスの数を返します (次に開けられるマス = 進展)
+func (r *tankResult) safeCount() int {
+	count := 0
+	for i := range r.frontier {
+		if r.mineWeight[i] == 0 {
+			count++
+		}
+	}
+	if len(r.interior) > 0 && r.interiorMine == 0 {
+		count += len(r.interior)
+	}
+	return count
+}
+
+// touches は p が set のいずれかのマスに隣接しているかを返します
+func (ts *TankSolver) touches(p pos, set map[pos]bool) bool {
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			if (dx != 0 || dy != 0) && set[pos{p.x + dx, p.y + dy}] {
+				return true
+			}
+		}
+	}
+	return false
+}
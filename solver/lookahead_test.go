@@ -0,0 +1,81 @@
+package solver
+
+import (
+	"math"
+	"testing"
+
+	"minesweeper/game"
+)
+
+// parseBoard は図から盤面を作ります
+// '*' は未開封の地雷、'.' は未開封の安全マス、'F' は旗を立てた地雷、'o' は開いた安全マスです
+func parseBoard(rows ...string) *game.Board {
+	b := game.NewBoard(len(rows[0]), len(rows), 0)
+	for y, row := range rows {
+		for x, ch := range row {
+			c := &b.Cells[y][x]
+			c.IsMine = ch == '*' || ch == 'F'
+			c.IsFlagged = ch == 'F'
+			c.IsRevealed = ch == 'o'
+			if c.IsMine {
+				b.MineCount++
+			}
+		}
+	}
+	for y := range b.Cells {
+		for x := range b.Cells[y] {
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if (dx != 0 || dy != 0) && b.Contains(x+dx, y+dy) && b.Cells[y+dy][x+dx].IsMine {
+						b.Cells[y][x].NeighborCount++
+					}
+				}
+			}
+		}
+	}
+	b.IsInitialized = true
+	return b
+}
+
+// TestLookaheadOutcomesSumToOne は、推測マスに出る数字 n ごとの配置数を足すと
+// そのマスが安全な配置数に一致する (Σ_n P(n | 安全) = 1) ことを確かめます
+// n = 0 の盤面で周りのマスが制約されないと、0 の分を余分に数えてしまいます
+func TestLookaheadOutcomesSumToOne(t *testing.T) {
+	b := parseBoard(
+		"oo....",
+		"oo.*..",
+		"o*....",
+		"......",
+		"..*...",
+	)
+	ts := NewTankSolver(b)
+	ts.deadline = stopAt(nil, DefaultTankBudget)
+	res := ts.analyze()
+	if res == nil {
+		t.Fatal("no layouts")
+	}
+	for _, p := range []pos{{2, 0}, {2, 2}, {4, 3}} {
+		safe := res.interiorProb
+		for i, f := range res.frontier {
+			if f == p {
+				safe = res.probs[i]
+			}
+		}
+		safe = 1 - safe
+
+		sum := 0.0
+		for n := 0; n <= 8; n++ {
+			h := b.Clone()
+			c := &h.Cells[p.y][p.x]
+			c.IsRevealed, c.IsMine, c.NeighborCount = true, false, n
+			sub := NewTankSolver(h)
+			sub.deadline = stopAt(nil, DefaultTankBudget)
+			if r := sub.analyze(); r != nil {
+				sum += math.Exp(r.logZ - res.logZ)
+			}
+		}
+		if math.Abs(sum-safe) > 1e-9 {
+			t.Errorf("%v: Σ_n Z(n)/Z = %.6f, want P(safe) = %.6f", p, sum, safe)
+		}
+	}
+}
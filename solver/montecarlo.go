@@ -0,0 +1,347 @@
+package solver
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"minesweeper/game"
+)
+
+const (
+	DefaultSampleBudget = 2000 // モンテカルロで集めるサンプル数の既定値
+
+	mcBeta        = 2.0  // 制約違反1つあたりのペナルティ (逆温度)
+	mcBurnIn      = 20   // 最初の有効サンプルまでに捨てるスイープ数
+	mcMaxSweeps   = 20   // サンプル1つあたりに許すスイープ数の上限
+	mcConfidenceZ = 1.96 // 95% 信頼区間
+	mcBatches     = 20   // 自己相関を見積もるバッチ平均法のバッチ数
+)
+
+// MonteCarloSolver は厳密に数えられないほど大きな境界について、
+// 盤面と矛盾しない地雷配置をマルコフ連鎖モンテカルロ法でサンプリングして確率を推定します
+//
+// 状態は境界の全マスの 0/1 割り当てで、制約 (数字) の違反数 E に対して
+// exp(-β E) × C(内側マス数, 残り地雷数 - 境界の地雷数) に比例する分布を目標にします
+// E = 0 の状態だけを数えれば、全体の地雷数まで考慮した正しい分布からのサンプルになります
+type MonteCarloSolver struct {
+	Board   *game.Board
+	Samples int             // 集めるサンプル数 (0 なら DefaultSampleBudget)
+	Budget  time.Duration   // 時間の上限 (0 なら DefaultTankBudget)
+	Rand    *rand.Rand      // サンプリングの乱数 (nil なら新しく作る)
+	Context context.Context // 取り消されたらそれまでのサンプルで推定する (nil なら Budget だけ)
+}
+
+func NewMonteCarloSolver(b *game.Board) *MonteCarloSolver {
+	return &MonteCarloSolver{Board: b}
+}
+
+// mcResult はサンプリングによる推定結果
+type mcResult struct {
+	frontier []pos
+	probs    []float64 // 推定地雷確率
+	upper    []float64 // 地雷確率の 95% 信頼区間の上限 (実効サンプル数で計算)
+
+	interior      []pos
+	interiorProb  float64
+	interiorUpper float64
+
+	samples  int
+	timedOut bool // 時間切れで予定のサンプル数に届かなかった
+}
+
+// Solve は推定確率が最も低いマスを返します
+// サンプリングでは「確定」は証明できないので、常に推測手 (IsGuess) として扱われます
+// Confidence は安全率の信頼区間の下限 (1 - 地雷確率の上限) です
+func (mc *MonteCarloSolver) Solve() *Move {
+	if !mc.Board.IsInitialized || done(mc.Context) {
+		return nil
+	}
+	res := mc.estimate()
+	if res == nil {
+		return nil
+	}
+
+	best := pos{}
+	bestProb, bestUpper := 2.0, 2.0
+	bestNeighbors := 9
+	consider := func(p pos, prob, upper float64) {
+		nb := neighborCount(mc.Board, p)
+		if prob < bestProb-linearEps || (prob < bestProb+linearEps && nb < bestNeighbors) {
+			best, bestProb, bestUpper, bestNeighbors = p, prob, upper, nb
+		}
+	}
+	for i, p := range res.frontier {
+		consider(p, res.probs[i], res.upper[i])
+	}
+	for _, p := range res.interior {
+		consider(p, res.interiorProb, res.interiorUpper)
+	}
+	if bestProb > 1 {
+		return nil
+	}
+	move := &Move{
+		X: best.x, Y: best.y,
+		Type:       MoveOpen,
+		Strategy:   StrategyMonteCarlo,
+		Confidence: 1.0 - bestUpper,
+		Reason: fmt.Sprintf("estimated %.1f%% mine probability from %s (at most %.1f%% with 95%% confidence)",
+			bestProb*100, plural(res.samples, "sampled solution"), bestUpper*100),
+		Approximate: res.timedOut,
+	}
+	if move.Approximate {
+		move.Reason += " (approximate: time limit reached)"
+	}
+	return move
+}
+
+// Step は Solve の推測手を1つだけ返します
+func (mc *MonteCarloSolver) Step() []Move {
+	return one(mc.Solve())
+}
+
+// Certain はサンプリングでは確定を証明できないので、常に nil を返します
+func (mc *MonteCarloSolver) Certain() []Move {
+	return nil
+}
+
+// estimate はサンプリングで各マスの地雷確率を推定します (有効なサンプルが無ければ nil)
+func (mc *MonteCarloSolver) estimate() *mcResult {
+	samples := mc.Samples
+	if samples <= 0 {
+		samples = DefaultSampleBudget
+	}
+	budget := mc.Budget
+	if budget <= 0 {
+		budget = DefaultTankBudget
+	}
+	deadline := stopAt(mc.Context, budget)
+	rng := mc.Rand
+	if rng == nil {
+		rng = newRand()
+	}
+
+	// 全セグメントをまとめて1つの変数集合として扱う
+	res := &mcResult{}
+	var rules []rule
+	res.frontier, rules, res.interior = NewTankSolver(mc.Board).flatten()
+
+	n := len(res.frontier)
+	if n == 0 {
+		return nil
+	}
+	varRules := make([][]int, n)
+	for ri, r := range rules {
+		for _, v := range r.cells {
+			varRules[v] = append(varRules[v], ri)
+		}
+	}
+
+	remaining := mc.Board.MineCount - mc.Board.GetFlagCount()
+	interior := len(res.interior)
+	logWeight := func(f int) float64 { return logChoose(interior, remaining-f) }
+
+	// 初期状態: 全て安全から始め、地雷数の重みが有限になるまで地雷を置く
+	state := make([]bool, n)
+	sums := make([]int, len(rules))
+	mines := 0
+	for _, v := range rng.Perm(n) {
+		if !math.IsInf(logWeight(mines), -1) {
+			break
+		}
+		state[v] = true
+		mines++
+		for _, ri := range varRules[v] {
+			sums[ri]++
+		}
+	}
+	if math.IsInf(logWeight(mines), -1) {
+		return nil
+	}
+	energy := 0
+	for ri, r := range rules {
+		energy += abs(sums[ri] - r.mines)
+	}
+
+	// flip は変数 v を反転したときのエネルギー差を返し、apply なら実際に反転します
+	flip := func(v int, apply bool) int {
+		d := 1
+		if state[v] {
+			d = -1
+		}
+		delta := 0
+		for _, ri := range varRules[v] {
+			m := rules[ri].mines
+			delta += abs(sums[ri]+d-m) - abs(sums[ri]-m)
+			if apply {
+				sums[ri] += d
+			}
+		}
+		if apply {
+			state[v] = !state[v]
+		}
+		return delta
+	}
+
+	counts := make([]float64, n)
+	interiorAcc := 0.0
+	recorded := 0
+
+	// 連鎖のサンプルは互いに相関するので、連続する batchSize 個ずつのバッチ平均のばらつきから
+	// 実効サンプル数を見積もります (バッチ平均法)
+	batchSize := max(1, samples/mcBatches)
+	batch := make([]float64, n+1) // 今のバッチの地雷数 (最後は内側の確率の和)
+	batchSum := make([]float64, n+1)
+	batchSq := make([]float64, n+1)
+	batches, inBatch := 0, 0
+	sweep := n
+	maxSteps := samples * sweep * mcMaxSweeps
+
+	for step := 0; step < maxSteps && recorded < samples; step++ {
+		if step%1024 == 0 && (time.Now().After(deadline) || done(mc.Context)) {
+			res.timedOut = true
+			break
+		}
+
+		// 提案: 1マスの反転か、地雷と安全の入れ替え (地雷数を保つ)
+		// 提案確率を対称に保つため、入れ替えで同じ状態の2マスを引いたら何もしない
+		a := rng.Intn(n)
+		b := -1
+		if rng.Intn(2) == 0 {
+			b = rng.Intn(n)
+			if state[a] == state[b] {
+				continue
+			}
+		}
+
+		oldMines := mines
+		delta := flip(a, true)
+		if state[a] {
+			mines++
+		} else {
+			mines--
+		}
+		if b >= 0 {
+			delta += flip(b, true)
+			if state[b] {
+				mines++
+			} else {
+				mines--
+			}
+		}
+
+		logRatio := -mcBeta*float64(delta) + logWeight(mines) - logWeight(oldMines)
+		if logRatio >= 0 || rng.Float64() < math.Exp(logRatio) {
+			energy += delta
+		} else {
+			// 却下: 元に戻す
+			if b >= 0 {
+				flip(b, true)
+			}
+			flip(a, true)
+			mines = oldMines
+		}
+
+		if step >= mcBurnIn*sweep && step%sweep == 0 && energy == 0 {
+			recorded++
+			for v, isMine := range state {
+				if isMine {
+					counts[v]++
+					batch[v]++
+				}
+			}
+			if interior > 0 {
+				q := float64(remaining-mines) / float64(interior)
+				interiorAcc += q
+				batch[n] += q
+			}
+			if inBatch++; inBatch == batchSize {
+				for v, c := range batch {
+					m := c / float64(batchSize)
+					batchSum[v] += m
+					batchSq[v] += m * m
+					batch[v] = 0
+				}
+				batches++
+				inBatch = 0
+			}
+		}
+	}
+	if recorded == 0 {
+		return nil
+	}
+
+	res.samples = recorded
+	res.probs = make([]float64, n)
+	res.upper = make([]float64, n)
+	for v := range counts {
+		res.probs[v] = counts[v] / float64(recorded)
+	}
+	if interior > 0 {
+		res.interiorProb = interiorAcc / float64(recorded)
+	}
+
+	// 全てのサンプルで同じ値だったマスからは相関を見積もれないので、
+	// 見積もれたマスのうち最も小さい実効サンプル数 (連鎖全体の混ざり具合) を使う
+	ess := make([]float64, n+1)
+	chain := math.Inf(1)
+	for v := range ess {
+		p := res.interiorProb
+		if v < n {
+			p = res.probs[v]
+		} else if interior == 0 {
+			continue
+		}
+		if e, ok := effectiveSamples(p, batchSum[v], batchSq[v], batches, recorded); ok {
+			ess[v] = e
+			chain = math.Min(chain, e)
+		}
+	}
+	if math.IsInf(chain, 1) {
+		chain = float64(max(1, batches)) // どのマスからも見積もれない: バッチ1つを独立なサンプル1つとみなす
+	}
+	for v := range ess {
+		if ess[v] == 0 {
+			ess[v] = chain
+		}
+	}
+	for v := range counts {
+		res.upper[v] = wilsonUpper(res.probs[v], ess[v])
+	}
+	if interior > 0 {
+		res.interiorUpper = wilsonUpper(res.interiorProb, ess[n])
+	}
+	return res
+}
+
+// effectiveSamples はバッチ平均の分散から、比率 p の推定に効く独立なサンプルの数を見積もります
+// 独立なら p(1-p)/n になるはずの平均の分散が、実際には (バッチ平均の分散)/バッチ数 なので、その比で数えます
+// バッチが2つ未満か、全てのバッチが同じ値で見積もれない場合は false を返します
+func effectiveSamples(p, sum, sq float64, batches, recorded int) (float64, bool) {
+	if batches < 2 || p <= 0 || p >= 1 {
+		return 0, false
+	}
+	b := float64(batches)
+	variance := (sq - sum*sum/b) / (b - 1)
+	if variance <= 0 {
+		return 0, false
+	}
+	return math.Max(1, math.Min(float64(recorded), p*(1-p)*b/variance)), true
+}
+
+// wilsonUpper は二項分布の比率 p (サンプル数 n) に対する Wilson 信頼区間の上限を返します
+func wilsonUpper(p float64, nf float64) float64 {
+	z := mcConfidenceZ
+	center := p + z*z/(2*nf)
+	margin := z * math.Sqrt(p*(1-p)/nf+z*z/(4*nf*nf))
+	return math.Min(1, (center+margin)/(1+z*z/nf))
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,133 @@
+package solver
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+
+	"minesweeper/game"
+)
+
+//go:embed openings.json
+var openingsJSON []byte
+
+// Opening はオープニングブックの1項目: ある盤面設定で最も勝率の高かった最初のクリック
+// cmd/book がシミュレーションで求めて openings.json に書き出します
+// 勝率は候補を選んだゲームとは別の種のゲームで測り直したもので、選んだことによる偏りがありません
+// 既定の opening ルールでは、今のブックに Better な項目はありません
+// (9x9 と 16x16 では既定の初手との差が有意でなく、30x16/99 では既定の初手の方が勝っています)
+// そのためブックが初手を決めるのは safe と any ルールの盤面だけです
+type Opening struct {
+	Width          int     `json:"width"`
+	Height         int     `json:"height"`
+	Mines          int     `json:"mines"`
+	FirstClick     string  `json:"first_click"` // game.FirstClickRule の名前
+	X              int     `json:"x"`
+	Y              int     `json:"y"`
+	WinRate        float64 `json:"win_rate"`
+	WinLow         float64 `json:"win_low"`          // WinRate の 95% 区間の下限
+	WinHigh        float64 `json:"win_high"`         // WinRate の 95% 区間の上限
+	DefaultWinRate float64 `json:"default_win_rate"` // 同じゲームで既定の初手 (ブックなし) を使った勝率
+	GainLow        float64 `json:"gain_low"`         // 既定の初手に対する勝率の差の 95% 区間の下限
+	Games          int     `json:"games"`            // 測り直したゲーム数
+}
+
+// Better は既定の初手より有意に勝率が高いかどうかを返します (そうでなければ初手はパイプラインに任せます)
+func (o Opening) Better() bool {
+	return o.GainLow > 0
+}
+
+var (
+	openingsOnce sync.Once
+	openings     []Opening
+)
+
+// OpeningBook は埋め込みのオープニングブックを返します
+func OpeningBook() []Opening {
+	openingsOnce.Do(func() {
+		// ブックはビルド時に埋め込まれるので、読めないのはプログラムの誤り
+		if err := json.Unmarshal(openingsJSON, &openings); err != nil {
+			panic(fmt.Sprintf("solver: broken embedded openings.json: %v", err))
+		}
+	})
+	return openings
+}
+
+// lookupOpening は盤面に合うブックの項目を返します
+// 同じ設定が無ければ、同じ初手ルールで地雷密度が最も近い項目を返します (exact = false)
+// 同じ設定の項目があっても既定の初手より良くなければ、ブックは使いません (ok = false)
+func lookupOpening(b *game.Board) (o Opening, exact, ok bool) {
+	rule := b.Rules.FirstClick.String()
+	density := float64(b.MineCount) / float64(b.Width*b.Height)
+	best := math.Inf(1)
+	for _, e := range OpeningBook() {
+		if e.FirstClick != rule {
+			continue
+		}
+		if e.Width == b.Width && e.Height == b.Height && e.Mines == b.MineCount {
+			return e, true, e.Better()
+		}
+		if !e.Better() {
+			continue
+		}
+		// 密度の差を優先し、同じくらいなら大きさの近いものを選ぶ
+		d := math.Abs(float64(e.Mines)/float64(e.Width*e.Height)-density)*1000 +
+			math.Abs(float64(e.Width*e.Height-b.Width*b.Height))/float64(b.Width*b.Height)
+		if d < best {
+			best, o, ok = d, e, true
+		}
+	}
+	return o, false, ok
+}
+
+// findOpeningMove は初手をオープニングブックから選びます
+// 地雷の分布や盤面の形が違う場合はブックの前提が合わないので使いません
+func (s *Solver) findOpeningMove() *Move {
+	b := s.Board
+	if b.IsInitialized || b.Mask != nil {
+		return nil
+	}
+	if _, uniform := b.Distribution.(game.Uniform); b.Distribution != nil && !uniform {
+		return nil
+	}
+	o, exact, ok := lookupOpening(b)
+	if !ok {
+		return nil
+	}
+
+	x, y := o.X, o.Y
+	reason := fmt.Sprintf("opening book: this first click won %.1f-%.1f%% (95%% interval) of %d simulated games on this board, against %.1f%% for the default first click",
+		o.WinLow*100, o.WinHigh*100, o.Games, o.DefaultWinRate*100)
+	if !exact {
+		// 端からの距離を保って写す (中央の項目は中央に写す)
+		x, y = mapOpening(o.X, o.Width, b.Width), mapOpening(o.Y, o.Height, b.Height)
+		reason = fmt.Sprintf("opening book: position taken from the closest simulated setup (%dx%d, %d mines, %.1f-%.1f%% wins)",
+			o.Width, o.Height, o.Mines, o.WinLow*100, o.WinHigh*100)
+	}
+	if !b.Contains(x, y) {
+		return nil
+	}
+
+	confidence := 1.0
+	if b.Rules.FirstClick == game.FirstClickAny {
+		confidence = 1 - float64(b.MineCount)/float64(b.Width*b.Height)
+	}
+	return &Move{
+		X: x, Y: y,
+		Type:       MoveOpen,
+		Strategy:   StrategyOpening,
+		Confidence: confidence,
+		Reason:     reason,
+	}
+}
+
+// mapOpening はブックの座標 v (長さ from) を長さ to の盤面に写します
+// ブックは対称性から左上の 1/4 だけを記録しているので、v は左端 (上端) からの距離です
+func mapOpening(v, from, to int) int {
+	if v == (from-1)/2 {
+		return (to - 1) / 2
+	}
+	return min(v, (to-1)/2)
+}
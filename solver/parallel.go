@@ -0,0 +1,75 @@
+package solver
+
+import "sync"
+
+// segCount は1つのセグメントを数えた結果 (countSegment の戻り値)
+type segCount struct {
+	sr *segResult
+	ok bool
+}
+
+// countAll は全セグメントを数え、segments と同じ順で結果を返します
+// キャッシュに無いセグメントが複数あれば Workers 個のゴルーチンで並列に数えます
+// 同時に数えるのは Workers 個までなので、メモリは Workers × StateLimit 程度に収まります
+// キャッシュの読み書きは呼び出し元のゴルーチンだけで行います
+func (ts *TankSolver) countAll(segments []*segment) []segCount {
+	counted := make([]segCount, len(segments))
+	var keys []string
+	var misses []int
+	if ts.cache != nil {
+		keys = make([]string, len(segments))
+	}
+	for i, seg := range segments {
+		if ts.cache != nil {
+			keys[i] = seg.signature()
+			if sr, ok := ts.cache.get(keys[i]); ok {
+				counted[i] = segCount{sr, true}
+				continue
+			}
+		}
+		misses = append(misses, i)
+	}
+
+	workers := ts.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	if workers > len(misses) {
+		workers = len(misses)
+	}
+
+	if workers <= 1 {
+		for _, i := range misses {
+			sr, ok := ts.countSegment(segments[i])
+			counted[i] = segCount{sr, ok}
+		}
+	} else {
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					sr, ok := ts.countSegment(segments[i])
+					counted[i] = segCount{sr, ok}
+				}
+			}()
+		}
+		for _, i := range misses {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+	}
+
+	// 上限に達して数えきれなかった結果 (ok = false) は時間に依存するので覚えません
+	if ts.cache != nil {
+		for _, i := range misses {
+			if counted[i].ok {
+				ts.cache.put(keys[i], counted[i].sr)
+			}
+		}
+	}
+	return counted
+}
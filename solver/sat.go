@@ -0,0 +1,446 @@
+package solver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"minesweeper/game"
+)
+
+// DefaultSATNodeLimit は1回の充足可能性判定で探索する節点数の上限
+const DefaultSATNodeLimit = 1 << 20
+
+// Backend はタンク段階 (確定マスの判定) に使う方式
+type Backend int
+
+const (
+	BackendTank Backend = iota // 解の数を数える (確率も求まる)
+	BackendSAT                 // 充足可能性だけを調べる (推測はモンテカルロに任せる)
+)
+
+// Analyzer は盤面全体を解析して次の一手を返す段階の共通インターフェース
+// TankSolver / SATSolver / MonteCarloSolver が実装します
+type Analyzer interface {
+	Solve() *Move
+	Certain() []Move // 1回の解析で確定する全てのマス
+	Step() []Move    // 確定する全てのマス、無ければ推測手1つ (1回の解析で)
+}
+
+// SATSolver は盤面を擬似ブール制約 (「これらのマスの地雷数は min 以上 max 以下」) の集まりとして表し、
+// 各境界マスについて「地雷」「安全」それぞれの仮定が充足不能かどうかを DPLL で判定します
+// 解の数を数えないので、境界が長くても確定マスの判定は完全なまま指数的な数え上げを避けられます
+type SATSolver struct {
+	Board     *game.Board
+	NodeLimit int             // 1回の判定の節点数の上限 (0 なら DefaultSATNodeLimit)
+	Budget    time.Duration   // 解析全体の時間の上限 (0 なら DefaultTankBudget)
+	Context   context.Context // 取り消されたら判定を打ち切る (nil なら Budget だけ)
+}
+
+func NewSATSolver(b *game.Board) *SATSolver {
+	return &SATSolver{Board: b}
+}
+
+// satResult は確定判定の結果
+// canMine[i] / canSafe[i] は、境界マス i が地雷/安全である解が存在する (または判定しきれなかった) かどうか
+type satResult struct {
+	frontier []pos
+	rules    []rule
+	canMine  []bool
+	canSafe  []bool
+
+	interior       []pos
+	interiorMine   bool // 内側に地雷がある解が存在する
+	interiorSafe   bool // 内側に安全マスがある解が存在する
+	interiorKnown  bool // 内側の判定が完了した
+	satisfiable    bool
+	incompleteness int // 上限に達して判定できなかった問い合わせの数
+}
+
+// Solve は充足不能な仮定から確定した安全マス (優先) または地雷を返します
+// 確定マスが無い場合は nil を返し、推測は後段に任せます
+func (sat *SATSolver) Solve() *Move {
+	moves := sat.Certain()
+	if len(moves) == 0 {
+		return nil
+	}
+	return &moves[0]
+}
+
+// Step は Certain と同じです (SAT は推測しないので、確定手が無ければ空)
+func (sat *SATSolver) Step() []Move {
+	return sat.Certain()
+}
+
+// Certain は確定した全てのマスを、安全マス -> 地雷 -> 内側のマスの順に返します
+func (sat *SATSolver) Certain() []Move {
+	if !sat.Board.IsInitialized || done(sat.Context) {
+		return nil
+	}
+	return sat.certain(sat.analyze())
+}
+
+// certain は解析結果から確定した手を集めます
+func (sat *SATSolver) certain(res *satResult) []Move {
+	if res == nil || !res.satisfiable {
+		return nil
+	}
+
+	var safe, flags []Move
+	for i, p := range res.frontier {
+		if !res.canMine[i] {
+			safe = append(safe, Move{
+				X: p.x, Y: p.y, Type: MoveOpen, Strategy: StrategySAT, Confidence: 1.0,
+				Reason:   "assuming a mine here contradicts the numbers, so it is safe",
+				Evidence: res.numbersAround(i),
+			})
+		} else if !res.canSafe[i] && !sat.Board.Cells[p.y][p.x].IsFlagged {
+			flags = append(flags, Move{
+				X: p.x, Y: p.y, Type: MoveFlag, Strategy: StrategySAT, Confidence: 1.0,
+				Reason:   "assuming this cell is safe contradicts the numbers, so it is a mine",
+				Evidence: res.numbersAround(i),
+			})
+		}
+	}
+	moves := append(safe, flags...)
+
+	if len(res.interior) > 0 && res.interiorKnown && (!res.interiorMine || !res.interiorSafe) {
+		remaining := sat.Board.MineCount - sat.Board.GetFlagCount()
+		for _, p := range res.interior {
+			move := Move{
+				X: p.x, Y: p.y, Type: MoveOpen, Strategy: StrategySAT, Confidence: 1.0,
+				Reason: fmt.Sprintf("all %d remaining mines must be on the frontier, so cells away from the numbers are safe", remaining),
+			}
+			if res.interiorMine {
+				move.Type = MoveFlag
+				move.Reason = fmt.Sprintf("the %d remaining mines fill every cell away from the numbers", remaining)
+			}
+			moves = append(moves, move)
+		}
+	}
+	return moves
+}
+
+// numbersAround は境界マス i に接している数字マスを返します
+func (res *satResult) numbersAround(i int) []Point {
+	var out []Point
+	for _, r := range res.rules {
+		for _, v := range r.cells {
+			if v == i {
+				out = append(out, Point{r.at.x, r.at.y})
+				break
+			}
+		}
+	}
+	return out
+}
+
+// analyze は全境界マスの「地雷になりうるか」「安全になりうるか」を調べます
+// 見つけた解はすべての変数について可能な値として記録するので、問い合わせの回数は
+// 多くの場合 境界マス数 よりずっと少なくなります
+func (sat *SATSolver) analyze() *satResult {
+	budget := sat.Budget
+	if budget <= 0 {
+		budget = DefaultTankBudget
+	}
+	limit := sat.NodeLimit
+	if limit <= 0 {
+		limit = DefaultSATNodeLimit
+	}
+
+	res := &satResult{}
+	res.frontier, res.rules, res.interior = NewTankSolver(sat.Board).flatten()
+	rules := res.rules
+	n := len(res.frontier)
+
+	// 数字マスごとの「ちょうど k 個」と、残り地雷数による境界全体の上下限
+	remaining := sat.Board.MineCount - sat.Board.GetFlagCount()
+	interior := len(res.interior)
+	cons := make([]cardinality, 0, len(rules)+1)
+	for _, r := range rules {
+		cons = append(cons, cardinality{cells: r.cells, min: r.mines, max: r.mines})
+	}
+	all := make([]int, n)
+	for i := range all {
+		all[i] = i
+	}
+	global := len(cons)
+	cons = append(cons, cardinality{cells: all, min: remaining - interior, max: remaining})
+
+	p := newCSP(n, cons, limit, stopAt(sat.Context, budget))
+	p.ctx = sat.Context
+	res.canMine = make([]bool, n)
+	res.canSafe = make([]bool, n)
+	record := func() {
+		mines := 0
+		for v, val := range p.value {
+			if val == 1 {
+				res.canMine[v] = true
+				mines++
+			} else {
+				res.canSafe[v] = true
+			}
+		}
+		if mines < remaining {
+			res.interiorMine = true
+		}
+		if mines > remaining-interior {
+			res.interiorSafe = true
+		}
+	}
+
+	// 盤面そのものが矛盾していないか
+	ok, complete := p.solve(-1, 0)
+	if !ok {
+		if !complete {
+			// 判定できなかったので何も確定させない
+			res.incompleteness++
+			for i := range res.frontier {
+				res.canMine[i], res.canSafe[i] = true, true
+			}
+			res.satisfiable = true
+		}
+		return res
+	}
+	res.satisfiable = true
+	record()
+
+	// 各境界マスについて、まだ解が見つかっていない側の値を仮定して調べる
+	for v := 0; v < n; v++ {
+		for _, val := range []int8{0, 1} {
+			known := res.canSafe[v]
+			if val == 1 {
+				known = res.canMine[v]
+			}
+			if known {
+				continue
+			}
+			ok, complete := p.solve(v, val)
+			if ok {
+				record()
+			} else if !complete {
+				// 判定しきれなかった値は「ありうる」として扱う (誤って確定させない)
+				res.incompleteness++
+				if val == 1 {
+					res.canMine[v] = true
+				} else {
+					res.canSafe[v] = true
+				}
+			}
+		}
+	}
+
+	// 内側のマスは全て同じ扱いなので、境界全体の地雷数の上下限を変えて調べる
+	res.interiorKnown = true
+	if interior > 0 {
+		g := cons[global]
+		if !res.interiorMine {
+			p.cons[global].max = remaining - 1
+			ok, complete := p.solve(-1, 0)
+			if ok {
+				record()
+			}
+			res.interiorKnown = res.interiorKnown && complete
+			p.cons[global] = g
+		}
+		if !res.interiorSafe {
+			p.cons[global].min = remaining - interior + 1
+			ok, complete := p.solve(-1, 0)
+			if ok {
+				record()
+			}
+			res.interiorKnown = res.interiorKnown && complete
+			p.cons[global] = g
+		}
+	}
+	return res
+}
+
+// --- 擬似ブール制約の DPLL ---
+
+// cardinality は「cells のうち地雷の数が min 以上 max 以下」という制約
+type cardinality struct {
+	cells    []int
+	min, max int
+}
+
+// csp は変数ごとの 0/1 割り当てと、制約ごとの集計 (地雷数と未割り当て数) を持つ探索状態
+type csp struct {
+	cons    []cardinality
+	varCons [][]int
+
+	value []int8 // -1 (未割り当て), 0 (安全), 1 (地雷)
+	phase []int8 // 最後に見つかった解での値 (次の探索で先に試す)
+	trail []int  // 割り当てた順の変数 (巻き戻し用)
+	mines []int  // 制約ごとの割り当て済み地雷数
+	open  []int  // 制約ごとの未割り当て変数数
+
+	nodes, limit int
+	deadline     time.Time
+	ctx          context.Context
+	aborted      bool
+}
+
+func newCSP(n int, cons []cardinality, limit int, deadline time.Time) *csp {
+	p := &csp{
+		cons:     cons,
+		varCons:  make([][]int, n),
+		value:    make([]int8, n),
+		phase:    make([]int8, n),
+		mines:    make([]int, len(cons)),
+		open:     make([]int, len(cons)),
+		limit:    limit,
+		deadline: deadline,
+	}
+	for ci, c := range cons {
+		for _, v := range c.cells {
+			p.varCons[v] = append(p.varCons[v], ci)
+		}
+	}
+	return p
+}
+
+// solve は (v >= 0 なら v = val を仮定して) 全制約を満たす割り当てがあるかを返します
+// 充足可能なら p.value にその解が残ります。上限に達した場合は complete = false
+func (p *csp) solve(v int, val int8) (sat, complete bool) {
+	for i := range p.value {
+		p.value[i] = -1
+	}
+	for ci, c := range p.cons {
+		p.mines[ci], p.open[ci] = 0, len(c.cells)
+	}
+	p.trail = p.trail[:0]
+	p.nodes, p.aborted = 0, false
+
+	ok := true
+	for ci := range p.cons {
+		if !p.check(ci) {
+			ok = false
+			break
+		}
+	}
+	if ok && v >= 0 && p.value[v] < 0 {
+		ok = p.set(v, val)
+	} else if ok && v >= 0 {
+		ok = p.value[v] == val
+	}
+	if ok && p.search() {
+		copy(p.phase, p.value)
+		return true, true
+	}
+	return false, !p.aborted
+}
+
+// search は未割り当ての変数を1つ選んで両方の値を試します (伝播付きの後戻り探索)
+func (p *csp) search() bool {
+	p.nodes++
+	if p.nodes > p.limit || (p.nodes%1024 == 0 && (time.Now().After(p.deadline) || done(p.ctx))) {
+		p.aborted = true
+		return false
+	}
+
+	v := p.pick()
+	if v < 0 {
+		return true
+	}
+	first := p.phase[v]
+	for _, val := range []int8{first, 1 - first} {
+		mark := len(p.trail)
+		if p.set(v, val) && p.search() {
+			return true
+		}
+		p.undo(mark)
+		if p.aborted {
+			return false
+		}
+	}
+	return false
+}
+
+// pick は割り当て途中の制約のうち未割り当てが最も少ないものから変数を選びます
+// 仮定したマスの周りから順に決めていくので、矛盾は無関係なセグメントを巻き込まずに見つかります
+func (p *csp) pick() int {
+	best, bestOpen := -1, 0
+	for ci, c := range p.cons {
+		open := p.open[ci]
+		if open == 0 || open == len(c.cells) || (best >= 0 && open >= bestOpen) {
+			continue
+		}
+		for _, v := range c.cells {
+			if p.value[v] < 0 {
+				best, bestOpen = v, open
+				break
+			}
+		}
+	}
+	if best >= 0 {
+		return best
+	}
+	for v, val := range p.value {
+		if val < 0 {
+			return v
+		}
+	}
+	return -1
+}
+
+// set は変数に値を割り当て、制約から決まる変数へ伝播させます。矛盾したら false
+func (p *csp) set(v int, val int8) bool {
+	p.value[v] = val
+	p.trail = append(p.trail, v)
+	for _, ci := range p.varCons[v] {
+		p.open[ci]--
+		if val == 1 {
+			p.mines[ci]++
+		}
+	}
+	for _, ci := range p.varCons[v] {
+		if !p.check(ci) {
+			return false
+		}
+	}
+	return true
+}
+
+// check は制約が満たせるかを調べ、残りの変数が全て決まる場合は割り当てます
+func (p *csp) check(ci int) bool {
+	c := p.cons[ci]
+	mines, open := p.mines[ci], p.open[ci]
+	if mines > c.max || mines+open < c.min {
+		return false
+	}
+	if open == 0 {
+		return true
+	}
+
+	var forced int8
+	switch {
+	case mines == c.max:
+		forced = 0 // これ以上置けない
+	case mines+open == c.min:
+		forced = 1 // 残り全部が地雷
+	default:
+		return true
+	}
+	for _, v := range c.cells {
+		if p.value[v] < 0 && !p.set(v, forced) {
+			return false
+		}
+	}
+	return true
+}
+
+// undo は割り当てを mark の時点まで巻き戻します
+func (p *csp) undo(mark int) {
+	for len(p.trail) > mark {
+		v := p.trail[len(p.trail)-1]
+		p.trail = p.trail[:len(p.trail)-1]
+		for _, ci := range p.varCons[v] {
+			p.open[ci]++
+			if p.value[v] == 1 {
+				p.mines[ci]--
+			}
+		}
+		p.value[v] = -1
+	}
+}
@@ -0,0 +1,136 @@
+package solver
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"minesweeper/game"
+)
+
+// TestTankAndSATAgree は種を固定した多数の局面で、タンクと SAT の確定手がどちらも実際の地雷と
+// 矛盾しないことと、確定手の集合が一致することを確かめます
+// SAT は節点数の上限に達すると確定させない (安全側に倒す) ので、その局面では SAT ⊆ タンク だけを求めます
+func TestTankAndSATAgree(t *testing.T) {
+	sizes := []struct{ w, h, mines, games int }{
+		{9, 9, 10, 30},
+		{16, 16, 40, 10},
+		{30, 16, 99, 3},
+	}
+	positions, partial := 0, 0
+	for _, sz := range sizes {
+		for g := 0; g < sz.games; g++ {
+			seed := int64(sz.w*1000 + g)
+			rng := rand.New(rand.NewSource(seed))
+			b := game.NewBoard(sz.w, sz.h, sz.mines)
+			b.Rand = rand.New(rand.NewSource(seed))
+			b.Open(sz.w/2, sz.h/2)
+
+			for step := 0; !b.IsFinished(); step++ {
+				name := fmt.Sprintf("%dx%d seed %d step %d", sz.w, sz.h, seed, step)
+				if compared, complete := compareCertain(t, name, b); compared {
+					positions++
+					if !complete {
+						partial++
+					}
+				}
+				if !advance(b, rng) {
+					break
+				}
+			}
+		}
+	}
+	if positions < 500 {
+		t.Fatalf("only %d positions were compared", positions)
+	}
+	t.Logf("%d positions compared (%d where SAT hit its node limit)", positions, partial)
+}
+
+// compareCertain は1つの局面で両方の確定手を比べ、SAT が全ての問い合わせを判定しきれたかを返します
+// タンクが全てのセグメントを数えきれなかった局面は比べられないので compared = false を返します
+func compareCertain(t *testing.T, name string, b *game.Board) (compared, complete bool) {
+	t.Helper()
+	ts := &TankSolver{Board: b, StateLimit: 1 << 22, Budget: time.Minute}
+	if res := ts.analyze(); res == nil || !res.exact {
+		return false, false
+	}
+	tank := ts.Certain()
+	solver := &SATSolver{Board: b, Budget: time.Minute}
+	res := solver.analyze()
+	sat := solver.certain(res)
+	complete = res.incompleteness == 0 && res.interiorKnown
+
+	for _, moves := range [][]Move{tank, sat} {
+		for _, m := range moves {
+			if mine := b.Cells[m.Y][m.X].IsMine; mine != (m.Type == MoveFlag) {
+				t.Errorf("%s: %s says %v at (%d,%d), but mine is %v", name, m.Strategy, m.Type, m.X, m.Y, mine)
+			}
+		}
+	}
+	only, missing := diffKeys(moveKeys(tank), moveKeys(sat))
+	if len(missing) > 0 || (complete && len(only) > 0) {
+		t.Errorf("%s: only tank %v, only SAT %v (SAT complete: %v)", name, only, missing, complete)
+	}
+	return true, complete
+}
+
+// moveKeys は手を並べ替えて比べられる文字列にします
+func moveKeys(moves []Move) []string {
+	keys := make([]string, len(moves))
+	for i, m := range moves {
+		keys[i] = fmt.Sprintf("%v(%d,%d)", m.Type, m.X, m.Y)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// diffKeys は a だけにある要素と b だけにある要素を返します
+func diffKeys(a, b []string) (onlyA, onlyB []string) {
+	inA, inB := map[string]bool{}, map[string]bool{}
+	for _, k := range a {
+		inA[k] = true
+	}
+	for _, k := range b {
+		inB[k] = true
+		if !inA[k] {
+			onlyB = append(onlyB, k)
+		}
+	}
+	for _, k := range a {
+		if !inB[k] {
+			onlyA = append(onlyA, k)
+		}
+	}
+	return onlyA, onlyB
+}
+
+// advance は局面を先に進めます: 地雷を知っているので、ランダムな安全マスを開けるか、
+// ときどき正しい旗を立てます。開けるマスが無ければ false を返します
+func advance(b *game.Board, rng *rand.Rand) bool {
+	var safe, mines [][2]int
+	for y := 0; y < b.Height; y++ {
+		for x := 0; x < b.Width; x++ {
+			c := b.Cells[y][x]
+			switch {
+			case c.IsRevealed || c.IsFlagged:
+			case c.IsMine:
+				mines = append(mines, [2]int{x, y})
+			default:
+				safe = append(safe, [2]int{x, y})
+			}
+		}
+	}
+	if len(safe) == 0 {
+		return false
+	}
+	if len(mines) > 0 && rng.Intn(4) == 0 {
+		p := mines[rng.Intn(len(mines))]
+		b.ToggleFlag(p[0], p[1])
+		return true
+	}
+	p := safe[rng.Intn(len(safe))]
+	b.Open(p[0], p[1])
+	return true
+}
@@ -1,6 +1,7 @@
 package solver
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"minesweeper/ai"
@@ -17,87 +18,120 @@ type MoveType int
 const (
 	MoveOpen MoveType = iota
 	MoveFlag
+	MoveUnflag // 間違った旗を外す (盤面が矛盾している場合)
+	MoveChord  // 開いた数字マスを両押しして、旗の無い周りのマスをまとめて開ける
 )
 
 type Move struct {
 	X, Y       int
 	Type       MoveType
 	IsGuess    bool
-	Strategy   string
+	Strategy   StrategyID
 	Confidence float64
+
+	Reason   string  // 人が読める説明 (例: "the 2 at (3,4) has 2 hidden neighbours")
+	Evidence []Point // 根拠になった数字マスなど
+
+	Approximate bool // 時間切れで解析を打ち切り、それまでの最善の手を返した
+}
+
+// Point は盤面上の座標 (Move の根拠の表示用)
+type Point struct {
+	X, Y int
 }
 
-// SolverMode : ソルバーの動作モード定義
+// points は内部の座標を Point に変換します
+func points(ps ...pos) []Point {
+	out := make([]Point, len(ps))
+	for i, p := range ps {
+		out[i] = Point{p.x, p.y}
+	}
+	return out
+}
+
+// SolverMode : ソルバーの動作モード定義 (Presets の代表的なものへの別名)
 type SolverMode int
 
 const (
-	ModeHybrid SolverMode = iota // Logic -> Advanced -> Tank -> AI (最強モード)
-	ModePureAI                   // AI Only (実験モード)
+	ModeHybrid    SolverMode = iota // Logic -> Advanced -> Linear -> Endgame -> Tank -> MonteCarlo -> AI (最強モード)
+	ModePureAI                      // AI Only (実験モード)
+	ModeLookahead                   // Hybrid + 推測を先読みで選ぶ
 )
 
 type Solver struct {
-	Board *game.Board
-	AiNet *ai.Network
-	Mode  SolverMode
+	Board    *game.Board
+	AiNet    *ai.Network
+	Mode     SolverMode
+	Pipeline Pipeline // 試す段階の並び (nil なら Mode のプリセット)
+
+	SampleBudget int        // モンテカルロのサンプル数 (0 なら DefaultSampleBudget)
+	Workers      int        // タンクでセグメントを並列に数えるゴルーチン数 (0 なら DefaultWorkers)
+	Rand         *rand.Rand // 推測に使う乱数 (nil なら最初の使用時に作る)。シードを固定すると結果を再現できます
+	Efficient    bool       // 確定手をクリック数が少なくなるように打つ (旗なし・旗+両押し、ClickPlan)
+
+	cache *segCache // 手をまたいで使い回すタンクの数え上げ結果
+	segs  *segState // 手をまたいで使い回すタンクのセグメント
+
+	trusted   map[pos]bool // 矛盾の無い盤面でソルバー自身が確定させた旗
+	trustedOn *game.Board  // trusted がどの盤面のものか
+	known     map[pos]bool // Efficient で、旗を立てずに覚えている確定した地雷
 }
 
 // New : モードを受け取るように変更
 func New(b *game.Board, mode SolverMode) *Solver {
-	net, err := ai.NewNetwork(game.GetWeightsJSON())
-	if err != nil {
-		fmt.Println("AI Load Error:", err)
-	}
-	return &Solver{Board: b, AiNet: net, Mode: mode}
+	s := NewWithPipeline(b, MustParsePipeline(modePresets[mode]))
+	s.Mode = mode
+	return s
 }
 
-// NextMove : モードに応じて戦略を切り替え
-func (s *Solver) NextMove() *Move {
-	if s.Mode == ModePureAI {
-		return s.nextMovePureAI()
-	}
-	return s.nextMoveHybrid()
+// NewWithPipeline は段階の並びを指定してソルバーを作ります
+// 同じ盤面で何手も使い回すと、タンクのセグメントとその数え上げ結果を再利用し、
+// 前の手から変わったマスの周りだけを作り直して数えます
+func NewWithPipeline(b *game.Board, p Pipeline) *Solver {
+	return &Solver{Board: b, AiNet: defaultNetwork(), Pipeline: p}
 }
 
-// 従来のハイブリッド戦略（最強）
-func (s *Solver) nextMoveHybrid() *Move {
-	// 1. 基本ロジック: 安全
-	if move := s.findSafeMove(); move != nil {
-		move.IsGuess = false
-		move.Strategy = "Logic"
-		move.Confidence = 1.0
-		return move
-	}
+// SetBoard は別の盤面 (新しいゲーム) に切り替え、前の盤面の解析結果を捨てます
+func (s *Solver) SetBoard(b *game.Board) {
+	s.Board = b
+	s.cache = nil
+	s.segs = nil
+	s.trusted = nil
+	s.known = nil
+}
 
-	// 2. 基本ロジック: 地雷
-	if move := s.findFlagMove(); move != nil {
-		move.IsGuess = false
-		move.Strategy = "Logic"
-		move.Confidence = 1.0
-		return move
+// NewFromConfig はプリセット名またはカンマ区切りの段階名からソルバーを作ります
+func NewFromConfig(b *game.Board, config string) (*Solver, error) {
+	p, err := ParsePipeline(config)
+	if err != nil {
+		return nil, err
 	}
-
-	// 3. 発展ロジック
-	if move := s.findAdvancedMove(); move != nil {
-		move.IsGuess = false
-		move.Strategy = "Advanced"
-		move.Confidence = 1.0
-		return move
+	s := NewWithPipeline(b, p)
+	if preset, ok := lookupPreset(config); ok {
+		s.Efficient = preset.Efficient
 	}
+	return s, nil
+}
 
-	// 4. タンクソルバー (全探索 & 厳密確率)
-	if move := s.findTankMove(); move != nil {
-		if move.Confidence == 1.0 {
-			move.IsGuess = false
-		} else {
-			move.IsGuess = true
+// NextMove : パイプラインの段階を順に試す
+// 旗のせいで盤面が矛盾している場合は、段階を試す前に旗を外す手 (MoveUnflag) を返します
+func (s *Solver) NextMove() *Move {
+	return s.NextMoveContext(context.Background())
+}
+
+func (s *Solver) nextMove(ctx context.Context) *Move {
+	if s.Pipeline == nil {
+		s.Pipeline = MustParsePipeline(modePresets[s.Mode])
+	}
+	trusted := s.flagsTrusted()
+	if !trusted {
+		if c := s.FindContradictionContext(ctx); c != nil {
+			return &c.Moves()[0]
 		}
-		return move
 	}
-
-	// 5. AI または ランダム
-	move := s.findRandomMove()
-	if move != nil {
-		move.IsGuess = true
+	move := s.Pipeline.Next(ctx, s)
+	if trusted && move != nil {
+		s.trust(*move)
 	}
 	return move
 }
@@ -111,15 +145,15 @@ func (s *Solver) nextMovePureAI() *Move {
 
 	bestProb := 1.0
 	var bestMove *Move
+	predict := s.memoPredict()
 
 	// 全マスをスキャンしてAIに判断させる
 	for y := 0; y < s.Board.Height; y++ {
 		for x := 0; x < s.Board.Width; x++ {
 			c := s.Board.Cells[y][x]
 			// 未開封かつフラグなしの場所を評価
-			if !c.IsRevealed && !c.IsFlagged {
-				input := s.createAiInput(x, y)
-				prob := s.AiNet.Predict(input)
+			if !c.IsRevealed && !c.IsFlagged && s.Board.IsPlayable(x, y) {
+				prob := predict(x, y)
 
 				// 最も安全（地雷確率が低い）手を選ぶ
 				if prob < bestProb {
@@ -127,8 +161,9 @@ func (s *Solver) nextMovePureAI() *Move {
 					bestMove = &Move{
 						X: x, Y: y,
 						Type:       MoveOpen,
-						Strategy:   "PureAI",
+						Strategy:   StrategyPureAI,
 						Confidence: 1.0 - prob,
+						Reason:     fmt.Sprintf("the AI rates this cell lowest (%.1f%% mine)", prob*100),
 					}
 				}
 			}
@@ -144,6 +179,25 @@ func (s *Solver) nextMovePureAI() *Move {
 // --- 以下、ロジック実装 ---
 
 func (s *Solver) findSafeMove() *Move {
+	ms := newMoveSet(1)
+	s.safeMoves(ms)
+	return ms.first()
+}
+
+func (s *Solver) findFlagMove() *Move {
+	ms := newMoveSet(1)
+	s.flagMoves(ms)
+	return ms.first()
+}
+
+func (s *Solver) findAdvancedMove() *Move {
+	ms := newMoveSet(1)
+	s.advancedMoves(ms)
+	return ms.first()
+}
+
+// safeMoves は旗の数が数字と一致したマスの、残りの隣接マスを集めます
+func (s *Solver) safeMoves(ms *moveSet) {
 	for y := 0; y < s.Board.Height; y++ {
 		for x := 0; x < s.Board.Width; x++ {
 			cell := s.Board.Cells[y][x]
@@ -151,16 +205,25 @@ func (s *Solver) findSafeMove() *Move {
 				continue
 			}
 			_, flags, hidden := s.getNeighborsInfo(x, y)
-			if flags == cell.NeighborCount && len(hidden) > 0 {
-				target := hidden[0]
-				return &Move{X: target.x, Y: target.y, Type: MoveOpen}
+			if flags != cell.NeighborCount {
+				continue
+			}
+			for _, target := range hidden {
+				full := ms.add(Move{
+					X: target.x, Y: target.y, Type: MoveOpen,
+					Reason:   fmt.Sprintf("the %d at (%d,%d) already has %s, so its other neighbours are safe", cell.NeighborCount, x, y, plural(flags, "flag")),
+					Evidence: points(pos{x, y}),
+				})
+				if full {
+					return
+				}
 			}
 		}
 	}
-	return nil
 }
 
-func (s *Solver) findFlagMove() *Move {
+// flagMoves は未開封マスの数が数字と一致したマスの、旗の無い隣接マスを集めます
+func (s *Solver) flagMoves(ms *moveSet) {
 	for y := 0; y < s.Board.Height; y++ {
 		for x := 0; x < s.Board.Width; x++ {
 			cell := s.Board.Cells[y][x]
@@ -168,19 +231,28 @@ func (s *Solver) findFlagMove() *Move {
 				continue
 			}
 			totalHidden, flags, hidden := s.getNeighborsInfo(x, y)
-			if totalHidden == cell.NeighborCount && (totalHidden-flags) > 0 {
-				for _, p := range hidden {
-					if !s.Board.Cells[p.y][p.x].IsFlagged {
-						return &Move{X: p.x, Y: p.y, Type: MoveFlag}
-					}
+			if totalHidden != cell.NeighborCount || (totalHidden-flags) == 0 {
+				continue
+			}
+			for _, p := range hidden {
+				if s.Board.Cells[p.y][p.x].IsFlagged {
+					continue
+				}
+				full := ms.add(Move{
+					X: p.x, Y: p.y, Type: MoveFlag,
+					Reason:   fmt.Sprintf("the %d at (%d,%d) has %s, so all of them are mines", cell.NeighborCount, x, y, plural(totalHidden, "hidden neighbour")),
+					Evidence: points(pos{x, y}),
+				})
+				if full {
+					return
 				}
 			}
 		}
 	}
-	return nil
 }
 
-func (s *Solver) findAdvancedMove() *Move {
+// advancedMoves は隣り合う2つの数字の包含関係から確定するマスを集めます
+func (s *Solver) advancedMoves(ms *moveSet) {
 	for y1 := 0; y1 < s.Board.Height; y1++ {
 		for x1 := 0; x1 < s.Board.Width; x1++ {
 			c1 := s.Board.Cells[y1][x1]
@@ -198,7 +270,7 @@ func (s *Solver) findAdvancedMove() *Move {
 				for dy := -1; dy <= 1; dy++ {
 					for dx := -1; dx <= 1; dx++ {
 						nx, ny := emptyPos.x+dx, emptyPos.y+dy
-						if nx < 0 || nx >= s.Board.Width || ny < 0 || ny >= s.Board.Height {
+						if !s.Board.Contains(nx, ny) {
 							continue
 						}
 						if nx == x1 && ny == y1 {
@@ -217,21 +289,37 @@ func (s *Solver) findAdvancedMove() *Move {
 						_, f2, h2 := s.getNeighborsInfo(nx, ny)
 						needed2 := c2.NeighborCount - f2
 
-						if isSubset(h1, h2) {
-							diff := getDifference(h2, h1)
-							if len(diff) == 0 {
-								continue
-							}
-							minesInDiff := needed2 - needed1
+						if !isSubset(h1, h2) {
+							continue
+						}
+						diff := getDifference(h2, h1)
+						if len(diff) == 0 {
+							continue
+						}
+						minesInDiff := needed2 - needed1
 
+						evidence := points(pos{x1, y1}, pos{nx, ny})
+						for _, target := range diff {
+							var move Move
 							if minesInDiff == 0 {
-								target := diff[0]
-								return &Move{X: target.x, Y: target.y, Type: MoveOpen}
-							} else if minesInDiff == len(diff) {
-								target := diff[0]
-								if !s.Board.Cells[target.y][target.x].IsFlagged {
-									return &Move{X: target.x, Y: target.y, Type: MoveFlag}
+								move = Move{
+									X: target.x, Y: target.y, Type: MoveOpen,
+									Reason: fmt.Sprintf("subset of the %d at (%d,%d): the %d at (%d,%d) needs no mines outside it",
+										c1.NeighborCount, x1, y1, c2.NeighborCount, nx, ny),
+									Evidence: evidence,
 								}
+							} else if minesInDiff == len(diff) && !s.Board.Cells[target.y][target.x].IsFlagged {
+								move = Move{
+									X: target.x, Y: target.y, Type: MoveFlag,
+									Reason: fmt.Sprintf("subset of the %d at (%d,%d): the %d at (%d,%d) needs %s in its %s",
+										c1.NeighborCount, x1, y1, c2.NeighborCount, nx, ny, plural(minesInDiff, "more mine"), plural(len(diff), "other cell")),
+									Evidence: evidence,
+								}
+							} else {
+								continue
+							}
+							if ms.add(move) {
+								return
 							}
 						}
 					}
@@ -239,31 +327,57 @@ func (s *Solver) findAdvancedMove() *Move {
 			}
 		}
 	}
-	return nil
 }
 
-func (s *Solver) findTankMove() *Move {
+// tankStage は方式に応じたタンク段階の解析器を返します
+func (s *Solver) tankStage(ctx context.Context, backend Backend, lookahead bool) Analyzer {
+	if backend == BackendSAT {
+		sat := NewSATSolver(s.Board)
+		sat.Context = ctx
+		return sat
+	}
+	if s.cache == nil {
+		s.cache = newSegCache()
+	}
+	s.cache.rotate()
+	if s.segs == nil {
+		s.segs = &segState{}
+	}
 	tank := NewTankSolver(s.Board)
-	return tank.Solve()
+	tank.Lookahead = lookahead
+	tank.Workers = s.Workers
+	tank.Context = ctx
+	tank.cache = s.cache
+	tank.segs = s.segs
+	return tank
+}
+
+func (s *Solver) findMonteCarloMove(ctx context.Context) *Move {
+	mc := NewMonteCarloSolver(s.Board)
+	mc.Samples = s.SampleBudget
+	mc.Rand = s.rng()
+	mc.Context = ctx
+	return mc.Solve()
 }
 
 func (s *Solver) findRandomMove() *Move {
 	if s.AiNet != nil {
 		bestProb := 1.0
 		var bestMove *Move
+		predict := s.memoPredict()
 		for y := 0; y < s.Board.Height; y++ {
 			for x := 0; x < s.Board.Width; x++ {
 				c := s.Board.Cells[y][x]
-				if !c.IsRevealed && !c.IsFlagged {
-					input := s.createAiInput(x, y)
-					prob := s.AiNet.Predict(input)
+				if !c.IsRevealed && !c.IsFlagged && s.Board.IsPlayable(x, y) {
+					prob := predict(x, y)
 					if prob < bestProb {
 						bestProb = prob
 						bestMove = &Move{
 							X: x, Y: y,
 							Type:       MoveOpen,
-							Strategy:   "AI",
+							Strategy:   StrategyAI,
 							Confidence: 1.0 - prob,
+							Reason:     fmt.Sprintf("no certain move; the AI rates this cell lowest (%.1f%% mine)", prob*100),
 						}
 					}
 				}
@@ -282,7 +396,7 @@ func (s *Solver) findPureRandomMove() *Move {
 	for y := 0; y < s.Board.Height; y++ {
 		for x := 0; x < s.Board.Width; x++ {
 			c := s.Board.Cells[y][x]
-			if !c.IsRevealed && !c.IsFlagged {
+			if !c.IsRevealed && !c.IsFlagged && s.Board.IsPlayable(x, y) {
 				candidates = append(candidates, point{x, y})
 			}
 		}
@@ -290,12 +404,44 @@ func (s *Solver) findPureRandomMove() *Move {
 	if len(candidates) == 0 {
 		return nil
 	}
-	choice := candidates[rand.Intn(len(candidates))]
+	choice := candidates[s.rng().Intn(len(candidates))]
 	return &Move{
 		X: choice.x, Y: choice.y,
 		Type:       MoveOpen,
-		Strategy:   "Random",
+		Strategy:   StrategyRandom,
 		Confidence: 0.0,
+		Reason:     fmt.Sprintf("no information; picked at random from %s", plural(len(candidates), "hidden cell")),
+	}
+}
+
+// rng はソルバーの乱数を返します
+func (s *Solver) rng() *rand.Rand {
+	if s.Rand == nil {
+		s.Rand = newRand()
+	}
+	return s.Rand
+}
+
+// newRand はパッケージの乱数から種を取った新しい乱数を作ります
+// rand.Rand はゴルーチン間で共有できないので、ソルバーごとに持たせます
+func newRand() *rand.Rand {
+	return rand.New(rand.NewSource(rand.Int63()))
+}
+
+// memoPredict は同じ周囲 5x5 に対する AI の推論を1回で済ませる関数を返します
+// 初手や広い未開封領域では同じ入力のマスが大半なので、推論の回数が大きく減ります
+func (s *Solver) memoPredict() func(x, y int) float64 {
+	memo := make(map[[25]float64]float64)
+	return func(x, y int) float64 {
+		input := s.createAiInput(x, y)
+		var key [25]float64
+		copy(key[:], input)
+		if prob, ok := memo[key]; ok {
+			return prob
+		}
+		prob := s.AiNet.Predict(input)
+		memo[key] = prob
+		return prob
 	}
 }
 
@@ -306,7 +452,7 @@ func (s *Solver) createAiInput(tx, ty int) []float64 {
 		for dx := -2; dx <= 2; dx++ {
 			nx, ny := tx+dx, ty+dy
 			val := 9.0
-			if nx >= 0 && nx < s.Board.Width && ny >= 0 && ny < s.Board.Height {
+			if s.Board.Contains(nx, ny) {
 				cell := s.Board.Cells[ny][nx]
 				if !cell.IsRevealed {
 					if cell.IsFlagged {
@@ -327,6 +473,14 @@ func (s *Solver) createAiInput(tx, ty int) []float64 {
 
 type pos struct{ x, y int }
 
+// plural は "1 flag" / "2 flags" のような数と名詞を返します
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
 func (s *Solver) getNeighborsInfo(cx, cy int) (totalHidden int, flags int, hiddenList []pos) {
 	for dy := -1; dy <= 1; dy++ {
 		for dx := -1; dx <= 1; dx++ {
@@ -334,7 +488,7 @@ func (s *Solver) getNeighborsInfo(cx, cy int) (totalHidden int, flags int, hidde
 				continue
 			}
 			nx, ny := cx+dx, cy+dy
-			if nx >= 0 && nx < s.Board.Width && ny >= 0 && ny < s.Board.Height {
+			if s.Board.Contains(nx, ny) {
 				neighbor := s.Board.Cells[ny][nx]
 				if !neighbor.IsRevealed {
 					totalHidden++
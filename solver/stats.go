@@ -0,0 +1,154 @@
+package solver
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"minesweeper/game"
+)
+
+// StrategyStats は1つの段階の集計
+type StrategyStats struct {
+	Moves    int           // 打った手の数
+	Guesses  int           // そのうち推測手の数
+	Survived int           // 推測手のうち地雷でなかった数
+	Time     time.Duration // 手を求めるのにかかった時間の合計
+}
+
+// SuccessRate は推測手で生き残った割合を返します (推測が無ければ 0)
+func (ss StrategyStats) SuccessRate() float64 {
+	if ss.Guesses == 0 {
+		return 0
+	}
+	return float64(ss.Survived) / float64(ss.Guesses)
+}
+
+// Stats は1ゲーム、または複数ゲームを合わせた段階ごとの集計です
+// wasm の報告とベンチマークで使います。ゲームごとに集計して Merge で合計できます
+type Stats struct {
+	Games       int
+	Wins        int
+	Clicks      int           // 勝ったゲームのクリック数の合計
+	BBBV        int           // 勝ったゲームの 3BV の合計
+	Approximate int           // 時間切れで打ち切られた手
+	Slowest     time.Duration // 最も時間のかかった1回の解析 (呼び出し側が Step で記録)
+	Hints       int           // 人間がヒントを見た局面の数 (Hint で記録)
+
+	Strategies [strategyCount]StrategyStats // StrategyID ごと
+
+	hinted *game.Board // 最後にヒントを数えた局面
+}
+
+// Hint は盤面 b でヒントが使われたことを記録し、新しい局面なら true を返します
+// 同じ局面で段階を上げて (1 -> 3) 見直しても、ヒントは1回と数えます
+func (st *Stats) Hint(b *game.Board) bool {
+	if changes, ok := game.Diff(st.hinted, b); ok && len(changes) == 0 {
+		return false
+	}
+	st.hinted = b.Clone()
+	st.Hints++
+	return true
+}
+
+// Record は盤面に打った手を1つ記録します
+// d はその手を求めるのにかかった時間、survived は手を打った後に生きているかどうかです
+func (st *Stats) Record(m Move, d time.Duration, survived bool) {
+	ss := &st.Strategies[st.index(m.Strategy)]
+	ss.Moves++
+	ss.Time += d
+	if m.IsGuess {
+		ss.Guesses++
+		if survived {
+			ss.Survived++
+		}
+	}
+	if m.Approximate {
+		st.Approximate++
+	}
+}
+
+// Apply は手を盤面に打って記録し、地雷を開けた場合は false を返します
+func (st *Stats) Apply(b *game.Board, m Move, d time.Duration) bool {
+	alive := m.Apply(b)
+	st.Record(m, d, alive)
+	return alive
+}
+
+// Step は1回の解析 (まとめて返った確定手の組や推測1手) にかかった時間を記録します
+func (st *Stats) Step(d time.Duration) {
+	if d > st.Slowest {
+		st.Slowest = d
+	}
+}
+
+// EndGame は終わった盤面の勝敗とクリック数を記録します
+func (st *Stats) EndGame(b *game.Board) {
+	st.Games++
+	if b.CheckClear() {
+		st.Wins++
+		st.Clicks += b.Clicks
+		st.BBBV += b.BBBV()
+	}
+}
+
+// Merge は o の集計を足し合わせます
+func (st *Stats) Merge(o *Stats) {
+	st.Games += o.Games
+	st.Wins += o.Wins
+	st.Clicks += o.Clicks
+	st.BBBV += o.BBBV
+	st.Approximate += o.Approximate
+	st.Hints += o.Hints
+	st.Step(o.Slowest)
+	for i, ss := range o.Strategies {
+		t := &st.Strategies[i]
+		t.Moves += ss.Moves
+		t.Guesses += ss.Guesses
+		t.Survived += ss.Survived
+		t.Time += ss.Time
+	}
+}
+
+// ByKind は分類ごとの手の数を返します
+func (st *Stats) ByKind() map[StrategyKind]int {
+	kinds := map[StrategyKind]int{}
+	for id := StrategyUnknown; id < strategyCount; id++ {
+		if n := st.Strategies[id].Moves; n > 0 {
+			kinds[id.Kind()] += n
+		}
+	}
+	return kinds
+}
+
+// Table は手を打った段階ごとに、手の数・推測の成功率・時間を表にした文字列を返します
+// 時間は1手あたりと、1ゲームあたり (Games が 0 なら合計) の両方を示します
+func (st *Stats) Table() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%-13s %7s %8s %8s %10s %10s\n", "Strategy", "Moves", "Guesses", "Success", "Avg time", "Per game")
+	for id := StrategyUnknown; id < strategyCount; id++ {
+		ss := st.Strategies[id]
+		if ss.Moves == 0 {
+			continue
+		}
+		success := "-"
+		if ss.Guesses > 0 {
+			success = fmt.Sprintf("%.1f%%", ss.SuccessRate()*100)
+		}
+		perGame := ss.Time
+		if st.Games > 0 {
+			perGame /= time.Duration(st.Games)
+		}
+		fmt.Fprintf(&sb, "%-13s %7d %8d %8s %10v %10v\n", id, ss.Moves, ss.Guesses, success,
+			(ss.Time / time.Duration(ss.Moves)).Round(time.Microsecond/10), perGame.Round(time.Microsecond))
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// index は範囲外の ID を StrategyUnknown として数えます
+func (st *Stats) index(id StrategyID) StrategyID {
+	if id < 0 || id >= strategyCount {
+		return StrategyUnknown
+	}
+	return id
+}
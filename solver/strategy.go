@@ -0,0 +1,300 @@
+package solver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Strategy はパイプラインの1段階です
+// 手が見つからなければ nil を返し、次の段階に任せます
+// ctx が終わったら重い解析は打ち切り、それまでの最善の手を返すか nil を返します
+type Strategy interface {
+	Name() string // 設定文字列で使う名前
+	Next(ctx context.Context, s *Solver) *Move
+}
+
+// Pipeline は Strategy を先頭から順に試す並び
+type Pipeline []Strategy
+
+// Next は最初に手を返した段階の手を返します
+func (p Pipeline) Next(ctx context.Context, s *Solver) *Move {
+	for _, st := range p {
+		if move := st.Next(ctx, s); move != nil {
+			return move
+		}
+	}
+	return nil
+}
+
+// String は ParsePipeline で読み戻せる設定文字列を返します
+func (p Pipeline) String() string {
+	names := make([]string, len(p))
+	for i, st := range p {
+		names[i] = st.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// Preset は名前付きのパイプライン設定
+type Preset struct {
+	Name        string
+	Config      string
+	Description string
+	Efficient   bool // 確定手をクリック数が少なくなるように打つ (Solver.Efficient)
+}
+
+// Presets はブラウザのモード選択やベンチマークで列挙するパイプラインの一覧 (先頭が既定)
+var Presets = []Preset{
+	{"hybrid", "opening,logic,advanced,linear,endgame,tank,montecarlo,ai", "Hybrid (Strongest)", false},
+	{"efficient", "opening,logic,advanced,linear,endgame,tank,montecarlo,ai", "Click-Efficient (Chords)", true},
+	{"lookahead", "opening,logic,advanced,linear,lookahead,montecarlo,ai", "Lookahead Guessing", false},
+	{"sat", "opening,logic,advanced,linear,sat,montecarlo,ai", "SAT Deduction", false},
+	{"noai", "opening,logic,advanced,linear,tank,montecarlo,random", "Logic Only (No AI)", false},
+	{"pure", "pureai", "Pure AI (Experimental)", false},
+}
+
+// modePresets は SolverMode に対応するプリセット名
+var modePresets = map[SolverMode]string{
+	ModeHybrid:    "hybrid",
+	ModePureAI:    "pure",
+	ModeLookahead: "lookahead",
+}
+
+// registryMu は registry を守ります (ParsePipeline はベンチマークなどのゴルーチンからも呼ばれる)
+var registryMu sync.RWMutex
+
+// registry は設定文字列で使える段階の名前と生成関数
+var registry = map[string]func() Strategy{
+	"opening":    func() Strategy { return openingStrategy{} },
+	"logic":      func() Strategy { return logicStrategy{} },
+	"advanced":   func() Strategy { return advancedStrategy{} },
+	"linear":     func() Strategy { return linearStrategy{} },
+	"endgame":    func() Strategy { return endgameStrategy{} },
+	"tank":       func() Strategy { return tankStrategy{name: "tank", backend: BackendTank} },
+	"lookahead":  func() Strategy { return tankStrategy{name: "lookahead", backend: BackendTank, lookahead: true} },
+	"sat":        func() Strategy { return tankStrategy{name: "sat", backend: BackendSAT} },
+	"montecarlo": func() Strategy { return monteCarloStrategy{} },
+	"ai":         func() Strategy { return aiStrategy{} },
+	"pureai":     func() Strategy { return pureAIStrategy{} },
+	"random":     func() Strategy { return randomStrategy{} },
+}
+
+// RegisterStrategy は設定文字列で使える段階を追加します (同じ名前なら置き換え)
+func RegisterStrategy(name string, factory func() Strategy) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[strings.ToLower(name)] = factory
+}
+
+// StrategyNames は登録されている段階の名前を返します
+func StrategyNames() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParsePipeline はプリセット名、または "logic,tank,ai" のようなカンマ区切りの段階名からパイプラインを作ります
+func ParsePipeline(config string) (Pipeline, error) {
+	config = strings.ToLower(strings.TrimSpace(config))
+	if config == "" {
+		config = Presets[0].Config
+	}
+	if p, ok := lookupPreset(config); ok {
+		config = p.Config
+	}
+
+	var pipeline Pipeline
+	for _, name := range strings.Split(config, ",") {
+		name = strings.TrimSpace(name)
+		registryMu.RLock()
+		factory, ok := registry[name]
+		registryMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown strategy: %q", name)
+		}
+		pipeline = append(pipeline, factory())
+	}
+	return pipeline, nil
+}
+
+// lookupPreset は名前が config のプリセットを返します
+func lookupPreset(config string) (Preset, bool) {
+	config = strings.ToLower(strings.TrimSpace(config))
+	for _, p := range Presets {
+		if p.Name == config {
+			return p, true
+		}
+	}
+	return Preset{}, false
+}
+
+// MustParsePipeline は ParsePipeline の結果を返し、失敗した場合は panic します (組み込みの設定用)
+func MustParsePipeline(config string) Pipeline {
+	p, err := ParsePipeline(config)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// --- 組み込みの段階 ---
+
+// certain は確定手としての項目を埋めます
+func certain(move *Move, strategy StrategyID) *Move {
+	if move != nil {
+		move.IsGuess = false
+		move.Strategy = strategy
+		move.Confidence = 1.0
+	}
+	return move
+}
+
+// guess は推測手として印を付けます
+func guess(move *Move) *Move {
+	if move != nil {
+		move.IsGuess = true
+	}
+	return move
+}
+
+// one は手1つを Step の戻り値にします (nil なら空)
+func one(move *Move) []Move {
+	if move == nil {
+		return nil
+	}
+	return []Move{*move}
+}
+
+// openingStrategy はオープニングブックによる初手 (初手以外では何もしない)
+type openingStrategy struct{}
+
+func (openingStrategy) Name() string                                 { return "opening" }
+func (openingStrategy) Next(_ context.Context, s *Solver) *Move      { return guess(s.findOpeningMove()) }
+func (openingStrategy) Certain(context.Context, *Solver) []Move      { return nil } // 推測のみ
+func (o openingStrategy) Step(ctx context.Context, s *Solver) []Move { return one(o.Next(ctx, s)) }
+
+// logicStrategy は数字と旗の数だけで決まる基本ロジック (安全 -> 地雷)
+type logicStrategy struct{}
+
+func (logicStrategy) Name() string { return "logic" }
+func (logicStrategy) Next(_ context.Context, s *Solver) *Move {
+	if move := s.findSafeMove(); move != nil {
+		return certain(move, StrategyLogic)
+	}
+	return certain(s.findFlagMove(), StrategyLogic)
+}
+func (logicStrategy) Certain(_ context.Context, s *Solver) []Move {
+	ms := newMoveSet(0)
+	s.safeMoves(ms)
+	s.flagMoves(ms)
+	return certainAll(ms.moves, StrategyLogic)
+}
+func (l logicStrategy) Step(ctx context.Context, s *Solver) []Move { return l.Certain(ctx, s) }
+
+// advancedStrategy は2つの数字の包含関係を使う発展ロジック
+type advancedStrategy struct{}
+
+func (advancedStrategy) Name() string { return "advanced" }
+func (advancedStrategy) Next(_ context.Context, s *Solver) *Move {
+	return certain(s.findAdvancedMove(), StrategyAdvanced)
+}
+func (advancedStrategy) Certain(_ context.Context, s *Solver) []Move {
+	ms := newMoveSet(0)
+	s.advancedMoves(ms)
+	return certainAll(ms.moves, StrategyAdvanced)
+}
+func (a advancedStrategy) Step(ctx context.Context, s *Solver) []Move { return a.Certain(ctx, s) }
+
+// linearStrategy は掃き出し法による線形代数
+type linearStrategy struct{}
+
+func (linearStrategy) Name() string { return "linear" }
+func (linearStrategy) Next(ctx context.Context, s *Solver) *Move {
+	return certain(s.findLinearMove(ctx), StrategyLinear)
+}
+func (linearStrategy) Certain(ctx context.Context, s *Solver) []Move {
+	ms := newMoveSet(0)
+	s.linearMoves(ctx, ms)
+	return certainAll(ms.moves, StrategyLinear)
+}
+func (l linearStrategy) Step(ctx context.Context, s *Solver) []Move { return l.Certain(ctx, s) }
+
+// endgameStrategy は終盤のゲーム木を探索し、勝率が最大になる推測を選びます
+type endgameStrategy struct{}
+
+func (endgameStrategy) Name() string { return "endgame" }
+func (endgameStrategy) Next(ctx context.Context, s *Solver) *Move {
+	return guess(s.findEndgameMove(ctx))
+}
+func (endgameStrategy) Certain(context.Context, *Solver) []Move      { return nil } // 推測のみ
+func (e endgameStrategy) Step(ctx context.Context, s *Solver) []Move { return one(e.Next(ctx, s)) }
+
+// tankStrategy は盤面全体の解析 (タンク / 先読み / SAT)
+type tankStrategy struct {
+	name      string
+	backend   Backend
+	lookahead bool
+}
+
+func (t tankStrategy) Name() string { return t.name }
+func (t tankStrategy) Next(ctx context.Context, s *Solver) *Move {
+	move := s.tankStage(ctx, t.backend, t.lookahead).Solve()
+	if move != nil {
+		move.IsGuess = move.Confidence != 1.0
+	}
+	return move
+}
+func (t tankStrategy) Certain(ctx context.Context, s *Solver) []Move {
+	return s.tankStage(ctx, t.backend, false).Certain()
+}
+
+// Step は確定手と推測を同じ解析から求めます (Certain の後に Next を呼ぶと2回解析する)
+func (t tankStrategy) Step(ctx context.Context, s *Solver) []Move {
+	moves := s.tankStage(ctx, t.backend, t.lookahead).Step()
+	for i := range moves {
+		moves[i].IsGuess = moves[i].Confidence != 1.0
+	}
+	return moves
+}
+
+// monteCarloStrategy は境界が大きすぎてタンクが数えきれない場合の推定確率
+type monteCarloStrategy struct{}
+
+func (monteCarloStrategy) Name() string { return "montecarlo" }
+func (monteCarloStrategy) Next(ctx context.Context, s *Solver) *Move {
+	return guess(s.findMonteCarloMove(ctx))
+}
+func (monteCarloStrategy) Certain(context.Context, *Solver) []Move      { return nil } // 推測のみ
+func (m monteCarloStrategy) Step(ctx context.Context, s *Solver) []Move { return one(m.Next(ctx, s)) }
+
+// aiStrategy は AI (読み込めなければランダム) による推測
+type aiStrategy struct{}
+
+func (aiStrategy) Name() string                                 { return "ai" }
+func (aiStrategy) Next(_ context.Context, s *Solver) *Move      { return guess(s.findRandomMove()) }
+func (aiStrategy) Certain(context.Context, *Solver) []Move      { return nil } // 推測のみ
+func (a aiStrategy) Step(ctx context.Context, s *Solver) []Move { return one(a.Next(ctx, s)) }
+
+// pureAIStrategy はロジックを使わず全マスを AI に評価させます
+type pureAIStrategy struct{}
+
+func (pureAIStrategy) Name() string                                 { return "pureai" }
+func (pureAIStrategy) Next(_ context.Context, s *Solver) *Move      { return s.nextMovePureAI() }
+func (pureAIStrategy) Certain(context.Context, *Solver) []Move      { return nil } // 推測のみ
+func (p pureAIStrategy) Step(ctx context.Context, s *Solver) []Move { return one(p.Next(ctx, s)) }
+
+// randomStrategy は未開封マスから一様に選びます
+type randomStrategy struct{}
+
+func (randomStrategy) Name() string                                 { return "random" }
+func (randomStrategy) Next(_ context.Context, s *Solver) *Move      { return guess(s.findPureRandomMove()) }
+func (randomStrategy) Certain(context.Context, *Solver) []Move      { return nil } // 推測のみ
+func (r randomStrategy) Step(ctx context.Context, s *Solver) []Move { return one(r.Next(ctx, s)) }
@@ -0,0 +1,71 @@
+package solver
+
+import "fmt"
+
+// StrategyID は手を見つけた段階の種類 (Move.Strategy)
+type StrategyID int
+
+const (
+	StrategyUnknown       StrategyID = iota // 段階が分からない手 (ゼロ値)
+	StrategyLogic                           // 数字と旗の数だけで決まる基本ロジック
+	StrategyAdvanced                        // 2つの数字の包含関係
+	StrategyLinear                          // 掃き出し法
+	StrategyTank                            // タンクの全配置の数え上げで確定
+	StrategySAT                             // SAT で確定
+	StrategyContradiction                   // 矛盾した旗を外す
+	StrategyChord                           // 両押しとそのための旗 (Efficient)
+	StrategyOpening                         // オープニングブックの初手
+	StrategyEndgame                         // 終盤のゲーム木探索による推測
+	StrategyTankProb                        // タンクの確率による推測
+	StrategyLookahead                       // 先読みによる推測
+	StrategyMonteCarlo                      // モンテカルロの推定確率による推測
+	StrategyAI                              // AI による推測
+	StrategyPureAI                          // ロジックを使わない AI
+	StrategyRandom                          // 一様な乱択
+	strategyCount
+)
+
+// strategyNames は表示と JSON に使う名前 (以前の Move.Strategy の文字列と同じ)
+var strategyNames = [strategyCount]string{
+	"Unknown", "Logic", "Advanced", "Linear", "Tank", "SAT", "Contradiction", "Chord",
+	"Opening", "Endgame", "Tank(Prob)", "Lookahead", "MonteCarlo", "AI", "PureAI", "Random",
+}
+
+func (id StrategyID) String() string {
+	if id >= 0 && id < strategyCount {
+		return strategyNames[id]
+	}
+	return fmt.Sprintf("StrategyID(%d)", int(id))
+}
+
+// StrategyKind は段階の大まかな分類です
+type StrategyKind int
+
+const (
+	KindDeduction StrategyKind = iota // 盤面から証明した確定手
+	KindGuess                         // 確率や AI で選んだ推測
+	KindRandom                        // 手がかりを使わない乱択
+)
+
+func (k StrategyKind) String() string {
+	switch k {
+	case KindDeduction:
+		return "Logic"
+	case KindGuess:
+		return "Guess"
+	case KindRandom:
+		return "Random"
+	}
+	return fmt.Sprintf("StrategyKind(%d)", int(k))
+}
+
+// Kind は段階の分類を返します
+func (id StrategyID) Kind() StrategyKind {
+	switch id {
+	case StrategyLogic, StrategyAdvanced, StrategyLinear, StrategyTank, StrategySAT, StrategyContradiction, StrategyChord:
+		return KindDeduction
+	case StrategyRandom:
+		return KindRandom
+	}
+	return KindGuess
+}
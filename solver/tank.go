@@ -1,12 +1,26 @@
 package solver
 
 import (
+	"context"
+	"fmt"
+	"math"
 	"minesweeper/game"
+	"sort"
+	"time"
 )
 
-// TankSolver はバックトラック探索を行う構造体
+// TankSolver は境界の全配置を数え上げて確率を求める構造体
 type TankSolver struct {
-	Board *game.Board
+	Board      *game.Board
+	StateLimit int             // セグメント1つあたりの状態数の上限 (0 なら DefaultStateLimit)
+	Budget     time.Duration   // 1回の解析の時間の上限 (0 なら DefaultTankBudget)
+	Lookahead  bool            // 推測マスを先読みで選ぶ (ModeLookahead)
+	Workers    int             // セグメントを並列に数えるゴルーチン数 (0 なら DefaultWorkers)
+	Context    context.Context // 取り消されたら数え上げを打ち切る (nil なら Budget だけ)
+
+	deadline time.Time
+	cache    *segCache // Solver から渡される、手をまたいだ数え上げ結果 (nil なら使わない)
+	segs     *segState // Solver から渡される、前回の解析のセグメント (nil なら毎回作る)
 }
 
 func NewTankSolver(b *game.Board) *TankSolver {
@@ -14,64 +28,446 @@ func NewTankSolver(b *game.Board) *TankSolver {
 }
 
 // Solve はタンクアルゴリズムを実行し、確定した安全な手または地雷を返します
+// 確定手が無い場合は、境界と内側の両方から最も安全なマスを確率付きで返します
 func (ts *TankSolver) Solve() *Move {
-	// 1. 全ての境界マスと、それに関連する数字マスを特定してグループ化（連結成分分解）
-	segments := ts.createSegments()
+	moves := ts.solve(1)
+	if len(moves) == 0 {
+		return nil
+	}
+	return &moves[0]
+}
 
-	var bestMove *Move
-	bestProb := 1.0 // 1.0 = 地雷確率100% (最悪)
+// Step は1回の解析で確定する全てのマスを返し、無ければ Solve と同じ推測手を1つ返します
+func (ts *TankSolver) Step() []Move {
+	return ts.solve(0)
+}
 
-	// 各セグメントごとに独立して解く
-	for _, seg := range segments {
-		// セグメントが大きすぎる場合は解けないのでスキップ
-		if len(seg.unknowns) > 18 { // 18程度が限界
-			continue
-		}
+// solve は確定手を limit 個まで (0 なら全て) 集め、無ければ推測手を1つ返します
+func (ts *TankSolver) solve(limit int) []Move {
+	// 初手は盤面に情報が無いので扱わない。期限切れなら次の段階に任せる
+	if !ts.Board.IsInitialized || done(ts.Context) {
+		return nil
+	}
+	res := ts.analyze()
+	if res == nil {
+		return nil
+	}
+
+	ms := newMoveSet(limit)
+	ts.collectCertain(res, ms)
+	if len(ms.moves) > 0 {
+		return ms.moves
+	}
+	if move := ts.guessMove(res); move != nil {
+		return []Move{*move}
+	}
+	return nil
+}
 
-		solutions := ts.solveSegment(seg)
-		if len(solutions) == 0 {
-			continue // 解なし（矛盾）
+// guessMove は確定手が無い場合の推測手 (最も安全なマス、Lookahead なら先読みで選んだマス) を返します
+func (ts *TankSolver) guessMove(res *tankResult) *Move {
+	// 解ききれなかったセグメントがある場合、確率は近似なので推測は別の段階に任せる
+	// ただし Context で打ち切られた場合は後の段階にも時間が無いので、近似のまま選ぶ
+	approximate := !res.exact
+	if approximate && !done(ts.Context) {
+		return nil
+	}
+
+	strategy := StrategyTankProb
+	guess := ts.bestGuess
+	if ts.Lookahead {
+		strategy = StrategyLookahead
+		guess = ts.lookaheadGuess
+	}
+	e, ok := guess(res)
+	if !ok {
+		return nil
+	}
+	move := &Move{
+		X: e.p.x, Y: e.p.y,
+		Type:        MoveOpen,
+		Strategy:    strategy,
+		Confidence:  1.0 - e.prob,
+		Reason:      fmt.Sprintf("lowest mine probability (%.1f%%) over %s", e.prob*100, formatCount(res.logZ, "solution")),
+		Approximate: approximate || e.approx,
+	}
+	if e.progress > 0 {
+		move.Reason = fmt.Sprintf("%.1f%% safe, with a %.0f%% chance that the revealed number gives a certain move",
+			(1-e.prob)*100, e.progress*100)
+	}
+	if move.Approximate {
+		move.Reason += " (approximate: time limit reached)"
+	}
+	if i := res.indexOf(e.p); i >= 0 {
+		move.Evidence = points(res.regions[res.region[i]].numbers...)
+	}
+	return move
+}
+
+// Certain は1回の解析で確定する全てのマスを返します
+func (ts *TankSolver) Certain() []Move {
+	if !ts.Board.IsInitialized || done(ts.Context) {
+		return nil
+	}
+	res := ts.analyze()
+	if res == nil {
+		return nil
+	}
+	ms := newMoveSet(0)
+	ts.collectCertain(res, ms)
+	return ms.moves
+}
+
+// collectCertain は確定した境界マスと、残り地雷数から確定する内側のマスを集めます
+func (ts *TankSolver) collectCertain(res *tankResult, ms *moveSet) {
+	for i, p := range res.frontier {
+		var move *Move
+		if res.mineWeight[i] == 0 {
+			// 確定安全 (0%)
+			move = res.certainMove(i, MoveOpen)
+		} else if res.safeWeight[i] == 0 && !ts.Board.Cells[p.y][p.x].IsFlagged {
+			// 確定地雷 (100%)
+			move = res.certainMove(i, MoveFlag)
+		}
+		if move != nil && ms.add(*move) {
+			return
 		}
+	}
 
-		// 各マスの地雷確率を計算
-		counts := make([]int, len(seg.unknowns))
-		for _, sol := range solutions {
-			for i, isMine := range sol {
-				if isMine {
-					counts[i]++
-				}
+	// 残り地雷数から内側 (境界に接していないマス) が確定する場合
+	// 解ききれなかったセグメントがあると内側の重みは正しくないので使わない
+	if !res.exact || len(res.interior) == 0 {
+		return
+	}
+	remaining := ts.Board.MineCount - ts.Board.GetFlagCount()
+	for _, p := range res.interior {
+		var move Move
+		switch {
+		case res.interiorMine == 0:
+			move = Move{
+				X: p.x, Y: p.y, Type: MoveOpen, Strategy: StrategyTank, Confidence: 1.0,
+				Reason: fmt.Sprintf("all %d remaining mines must be on the frontier, so cells away from the numbers are safe", remaining),
+			}
+		case res.interiorSafe == 0:
+			move = Move{
+				X: p.x, Y: p.y, Type: MoveFlag, Strategy: StrategyTank, Confidence: 1.0,
+				Reason: fmt.Sprintf("the %d remaining mines fill every cell away from the numbers", remaining),
 			}
+		default:
+			return
 		}
+		if ms.add(move) {
+			return
+		}
+	}
+}
 
-		total := float64(len(solutions))
-		for i, count := range counts {
-			prob := float64(count) / total
-			pos := seg.unknowns[i]
+// certainMove は境界マス i の確定手を、解の数による説明付きで返します
+func (res *tankResult) certainMove(i int, t MoveType) *Move {
+	p := res.frontier[i]
+	reg := res.regions[res.region[i]]
+	reason := fmt.Sprintf("all %s of its %d-cell region agree", formatCount(reg.logCount, "solution"), reg.size)
+	if !res.alone[i] {
+		reason = fmt.Sprintf("all solutions of its %d-cell region that fit the remaining mine count agree", reg.size)
+	}
+	return &Move{
+		X: p.x, Y: p.y, Type: t, Strategy: StrategyTank, Confidence: 1.0,
+		Reason:   reason,
+		Evidence: points(reg.numbers...),
+	}
+}
 
-			// 確定安全 (0%)
-			if prob == 0.0 {
-				return &Move{X: pos.x, Y: pos.y, Type: MoveOpen, Strategy: "Tank", Confidence: 1.0}
+// indexOf は境界マス p の番号を返します (内側のマスなら -1)
+func (res *tankResult) indexOf(p pos) int {
+	for i, q := range res.frontier {
+		if q == p {
+			return i
+		}
+	}
+	return -1
+}
+
+// formatCount は対数で持っている数を名詞付きの表示用の文字列にします
+func formatCount(logCount float64, word string) string {
+	if logCount < math.Log(1e9) {
+		return plural(int(math.Round(math.Exp(logCount))), word)
+	}
+	return fmt.Sprintf("about %.2g %ss", math.Exp(logCount), word)
+}
+
+// bestGuess は境界と内側のマスから地雷確率が最も低いマスを選びます
+// 同じ確率なら隣接マスが少ない (角 -> 辺 -> 中央の順) マスを優先します
+// 角や辺は周りの数字が少ない代わりに、0 が出て連鎖しやすいためです
+func (ts *TankSolver) bestGuess(res *tankResult) (guessEval, bool) {
+	best := pos{}
+	bestProb := 2.0
+	bestNeighbors := 9
+	consider := func(p pos, prob float64) {
+		nb := neighborCount(ts.Board, p)
+		if prob < bestProb-linearEps || (prob < bestProb+linearEps && nb < bestNeighbors) {
+			best, bestProb, bestNeighbors = p, prob, nb
+		}
+	}
+
+	for i, p := range res.frontier {
+		consider(p, res.probs[i])
+	}
+	for _, p := range res.interior {
+		consider(p, res.interiorProb)
+	}
+	return guessEval{p: best, prob: bestProb}, bestProb <= 1.0
+}
+
+// neighborCount は盤面内に存在する隣接マスの数を返します (角なら3、辺なら5)
+func neighborCount(b *game.Board, p pos) int {
+	count := 0
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			if (dx != 0 || dy != 0) && b.Contains(p.x+dx, p.y+dy) {
+				count++
 			}
-			// 確定地雷 (100%)
-			if prob == 1.0 && !ts.Board.Cells[pos.y][pos.x].IsFlagged {
-				return &Move{X: pos.x, Y: pos.y, Type: MoveFlag, Strategy: "Tank", Confidence: 1.0}
+		}
+	}
+	return count
+}
+
+// tankResult は盤面全体の地雷数制約を考慮した確率の計算結果
+type tankResult struct {
+	frontier   []pos     // 数字に接している未開封マス
+	probs      []float64 // frontier の各マスの地雷確率
+	mineWeight []float64 // 地雷である配置の重み (0 なら確定安全)
+	safeWeight []float64 // 安全である配置の重み (0 なら確定地雷)
+
+	interior     []pos // どの数字にも接していない未開封マス
+	interiorProb float64
+	interiorMine float64 // 内側の1マスが地雷である重み
+	interiorSafe float64 // 内側の1マスが安全である重み
+
+	exact bool    // 全セグメントを厳密に解けたか
+	logZ  float64 // 盤面と矛盾しない地雷配置の総数の対数 (盤面どうしで比較できる)
+
+	// 説明用
+	region  []int        // frontier の各マスが属する regions の番号
+	regions []tankRegion // 解いたセグメントごとの情報
+	alone   []bool       // 残り地雷数を使わず、セグメント単独の解だけで確定するか
+}
+
+// tankRegion は解いたセグメント1つの説明用の情報
+type tankRegion struct {
+	numbers  []pos   // 制約になった数字マス
+	size     int     // 未開封マスの数
+	logCount float64 // 解の数の対数
+}
+
+// segResult は1つのセグメントを解いた結果を地雷数ごとに集計したもの
+// counts[k] は地雷が k 個の解の数、cellMine[i][k] / cellSafe[i][k] はそのうちマス i が地雷/安全の数
+type segResult struct {
+	counts   []float64
+	cellMine [][]float64
+	cellSafe [][]float64
+	logScale float64 // normalize で割った値の対数
+}
+
+// analyze は各セグメントの解を、残り地雷数と内側のマス数で重み付けして合成します
+// 解の無いセグメントがある場合は盤面が矛盾しているので nil を返します
+// 地雷数 F の境界配置1つに対して、内側の配置は C(内側マス数, 残り地雷数 - F) 通りあります
+func (ts *TankSolver) analyze() *tankResult {
+	budget := ts.Budget
+	if budget <= 0 {
+		budget = DefaultTankBudget
+	}
+	ts.deadline = stopAt(ts.Context, budget)
+
+	segments := ts.createSegments()
+	res := &tankResult{exact: true}
+
+	inSegment := make(map[pos]bool)
+	var solved []*segment
+	var results []*segResult
+	counted := ts.countAll(segments)
+	for i, seg := range segments {
+		sr, ok := counted[i].sr, counted[i].ok
+		if !ok {
+			// 上限内に数えきれなかったセグメントは内側のマスとして扱う (近似)
+			res.exact = false
+			continue
+		}
+		for _, p := range seg.unknowns {
+			inSegment[p] = true
+		}
+		if sr == nil {
+			return nil // 解なし (旗が間違っている。FindContradiction で原因を探せます)
+		}
+		solved = append(solved, seg)
+		results = append(results, sr)
+	}
+
+	for y := 0; y < ts.Board.Height; y++ {
+		for x := 0; x < ts.Board.Width; x++ {
+			c := ts.Board.Cells[y][x]
+			if c.IsRevealed || c.IsFlagged || !ts.Board.IsPlayable(x, y) || inSegment[pos{x, y}] {
+				continue
 			}
+			res.interior = append(res.interior, pos{x, y})
+		}
+	}
+
+	remaining := ts.Board.MineCount - ts.Board.GetFlagCount()
+	interior := len(res.interior)
 
-			// 最善手（確率）の更新
-			// 確率が低いほうが安全
-			if prob < bestProb {
-				bestProb = prob
-				bestMove = &Move{
-					X: pos.x, Y: pos.y,
-					Type:       MoveOpen,
-					Strategy:   "Tank(Prob)",
-					Confidence: 1.0 - prob,
+	// weight[F] = C(interior, remaining - F) を最大値で正規化したもの
+	maxF := 0
+	for _, sr := range results {
+		maxF += len(sr.counts) - 1
+	}
+	weight := make([]float64, maxF+1)
+	logs := make([]float64, maxF+1)
+	maxLog := math.Inf(-1)
+	for f := range weight {
+		logs[f] = logChoose(interior, remaining-f)
+		if logs[f] > maxLog {
+			maxLog = logs[f]
+		}
+	}
+	if !res.exact {
+		// 解ききれなかったセグメントがあると内側のマス数が正しくないので、
+		// 全体の地雷数による重み付けはせず、各セグメント単独で確定するマスだけを残す
+		maxLog = 0
+		for f := range weight {
+			logs[f] = 0
+		}
+	}
+	if math.IsInf(maxLog, -1) {
+		return nil // 残り地雷数と矛盾している
+	}
+	for f := range weight {
+		weight[f] = math.Exp(logs[f] - maxLog)
+	}
+
+	// prefix[i] はセグメント 0..i-1、suffix[i] はセグメント i.. の地雷数分布の畳み込み
+	n := len(results)
+	prefix := make([][]float64, n+1)
+	suffix := make([][]float64, n+1)
+	prefix[0] = []float64{1}
+	suffix[n] = []float64{1}
+	for i := 0; i < n; i++ {
+		prefix[i+1] = convolve(prefix[i], results[i].counts)
+	}
+	for i := n - 1; i >= 0; i-- {
+		suffix[i] = convolve(results[i].counts, suffix[i+1])
+	}
+
+	total := prefix[n]
+	z := 0.0
+	for f, c := range total {
+		z += c * weight[f]
+		if left := remaining - f; interior > 0 && left >= 0 && left <= interior {
+			res.interiorMine += c * weight[f] * float64(remaining-f) / float64(interior)
+			res.interiorSafe += c * weight[f] * float64(interior-remaining+f) / float64(interior)
+		}
+	}
+	if z == 0 {
+		return nil
+	}
+	res.logZ = maxLog + math.Log(z)
+	for _, sr := range results {
+		res.logZ += sr.logScale
+	}
+	if interior > 0 {
+		res.interiorProb = res.interiorMine / z
+	}
+
+	for si, sr := range results {
+		reg := tankRegion{size: len(solved[si].unknowns), logCount: sr.logScale}
+		sum := 0.0
+		for _, c := range sr.counts {
+			sum += c
+		}
+		reg.logCount += math.Log(sum)
+		for _, r := range solved[si].rules {
+			reg.numbers = append(reg.numbers, r.at)
+		}
+		res.regions = append(res.regions, reg)
+
+		others := convolve(prefix[si], suffix[si+1])
+		// g[k] = このセグメントの地雷が k 個のときの、他の全ての部分の重みの合計
+		g := make([]float64, len(sr.counts))
+		for k := range g {
+			for f, c := range others {
+				if k+f < len(weight) {
+					g[k] += c * weight[k+f]
 				}
 			}
 		}
+
+		for i, p := range solved[si].unknowns {
+			mine, safe := 0.0, 0.0
+			localMine, localSafe := 0.0, 0.0
+			for k := range g {
+				mine += sr.cellMine[i][k] * g[k]
+				safe += sr.cellSafe[i][k] * g[k]
+				localMine += sr.cellMine[i][k]
+				localSafe += sr.cellSafe[i][k]
+			}
+			res.region = append(res.region, si)
+			res.alone = append(res.alone, localMine == 0 || localSafe == 0)
+			res.frontier = append(res.frontier, p)
+			res.mineWeight = append(res.mineWeight, mine)
+			res.safeWeight = append(res.safeWeight, safe)
+			res.probs = append(res.probs, mine/(mine+safe))
+		}
 	}
 
-	return bestMove
+	return res
+}
+
+// normalize は桁あふれを防ぐため、最大値が 1 になるように全体を割ります
+// 確率は比なので、セグメントごとの定数倍は結果に影響しません
+func (sr *segResult) normalize() {
+	max := 0.0
+	for _, c := range sr.counts {
+		if c > max {
+			max = c
+		}
+	}
+	if max == 0 {
+		return
+	}
+	sr.logScale = math.Log(max)
+	for k := range sr.counts {
+		sr.counts[k] /= max
+	}
+	for i := range sr.cellMine {
+		for k := range sr.cellMine[i] {
+			sr.cellMine[i][k] /= max
+			sr.cellSafe[i][k] /= max
+		}
+	}
+}
+
+// convolve は地雷数分布どうしの畳み込みを返します
+func convolve(a, b []float64) []float64 {
+	out := make([]float64, len(a)+len(b)-1)
+	for i, x := range a {
+		if x == 0 {
+			continue
+		}
+		for j, y := range b {
+			out[i+j] += x * y
+		}
+	}
+	return out
+}
+
+// logChoose は log C(n, k) を返します (k が範囲外なら -Inf)
+func logChoose(n, k int) float64 {
+	if k < 0 || k > n {
+		return math.Inf(-1)
+	}
+	a, _ := math.Lgamma(float64(n + 1))
+	b, _ := math.Lgamma(float64(k + 1))
+	c, _ := math.Lgamma(float64(n - k + 1))
+	return a - b - c
 }
 
 // --- セグメント（連結成分）管理 ---
@@ -84,68 +480,81 @@ type segment struct {
 type rule struct {
 	cells []int // unknownsのインデックスのリスト
 	mines int   // 必要な地雷数
+	at    pos   // 元の数字マス
 }
 
+// createSegments は境界を連結成分 (セグメント) に分けて返します
+// Solver から前回のセグメントを渡されていれば、変わったマスの周りだけ作り直します
 func (ts *TankSolver) createSegments() []*segment {
-	// 1. 全ての「数字マス」と「それに隣接する未開封マス」の関係をリスト化
-	unknownMap := make(map[int]pos) // key: y*w+x
-	numberedCells := []pos{}
+	if ts.segs != nil {
+		return ts.segs.update(ts)
+	}
+	return ts.buildSegments(ts.constraints(nil))
+}
+
+// isConstraint は (x, y) が未開封マスに接する開いたマス (セグメントのルールになるマス) かを返します
+func (ts *TankSolver) isConstraint(x, y int) bool {
+	c := ts.Board.Cells[y][x]
+	// 開いた 0 の周りは普通は連鎖で開いているが、先読みで 0 が出たと仮定した盤面では
+	// 周りが未開封のまま残るので、「地雷 0 個」の制約として含める
+	// 旗で満たされた数字も「残り0個」の制約として含める
+	if !c.IsRevealed || c.IsMine {
+		return false
+	}
+	hidden, _, _ := ts.getNeighbors(x, y)
+	return hidden > 0
+}
 
+// constraints はルールになるマスを行優先の順に返します (area が nil なら盤面全体、あればその中だけ)
+func (ts *TankSolver) constraints(area map[pos]bool) []pos {
+	var cells []pos
 	for y := 0; y < ts.Board.Height; y++ {
 		for x := 0; x < ts.Board.Width; x++ {
-			c := ts.Board.Cells[y][x]
-			if c.IsRevealed && c.NeighborCount > 0 {
-				// 周囲の未開封をチェック
-				hasUnknown := false
-				_, flags, _ := ts.getNeighbors(x, y)
-				if flags == c.NeighborCount {
-					continue
-				}
-
-				for dy := -1; dy <= 1; dy++ {
-					for dx := -1; dx <= 1; dx++ {
-						if dx == 0 && dy == 0 {
-							continue
-						}
-						nx, ny := x+dx, y+dy
-						if nx >= 0 && nx < ts.Board.Width && ny >= 0 && ny < ts.Board.Height {
-							neighbor := ts.Board.Cells[ny][nx]
-							if !neighbor.IsRevealed && !neighbor.IsFlagged {
-								key := ny*ts.Board.Width + nx
-								unknownMap[key] = pos{nx, ny}
-								hasUnknown = true
-							}
-						}
-					}
-				}
-				if hasUnknown {
-					numberedCells = append(numberedCells, pos{x, y})
-				}
+			if (area == nil || area[pos{x, y}]) && ts.Board.Contains(x, y) && ts.isConstraint(x, y) {
+				cells = append(cells, pos{x, y})
 			}
 		}
 	}
+	return cells
+}
+
+// buildSegments は数字マス (行優先の順) から、それらに接する未開封マスのセグメントを作ります
+// 同じ盤面から毎回同じセグメント (マスとルールの順序も含めて) を作るので、segCache のキーが一致します
+func (ts *TankSolver) buildSegments(numberedCells []pos) []*segment {
+	w := ts.Board.Width
 
-	// 2. 連結成分分解
+	// 1. 数字マスと、それに隣接する未開封マスの関係をリスト化
 	// unknownsをノード、数字マスをエッジとしたグラフを作る
-	adj := make(map[int][]int) // unknownKey -> []unknownKey
-
-	for _, numPos := range numberedCells {
-		_, _, neighbors := ts.getNeighbors(numPos.x, numPos.y)
-		for i := 0; i < len(neighbors)-1; i++ {
-			u1 := neighbors[i].y*ts.Board.Width + neighbors[i].x
-			for j := i + 1; j < len(neighbors); j++ {
-				u2 := neighbors[j].y*ts.Board.Width + neighbors[j].x
+	unknownMap := make(map[int]pos) // key: y*w+x
+	adj := make(map[int][]int)      // unknownKey -> []unknownKey
+	hiddenOf := make([][]pos, len(numberedCells))
+	flagsOf := make([]int, len(numberedCells))
+	for i, numPos := range numberedCells {
+		_, flags, neighbors := ts.getNeighbors(numPos.x, numPos.y)
+		hiddenOf[i], flagsOf[i] = neighbors, flags
+		for j, n := range neighbors {
+			u1 := n.y*w + n.x
+			unknownMap[u1] = n
+			for _, m := range neighbors[j+1:] {
+				u2 := m.y*w + m.x
 				adj[u1] = append(adj[u1], u2)
 				adj[u2] = append(adj[u2], u1)
 			}
 		}
 	}
 
+	// 2. 連結成分分解 (キーを昇順に辿る)
+	keys := make([]int, 0, len(unknownMap))
+	for key := range unknownMap {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+
 	visited := make(map[int]bool)
+	segOf := make(map[int]int)         // unknownKey -> セグメント番号
+	localIndexMap := make(map[int]int) // unknownKey -> セグメント内の番号
 	var segments []*segment
-
-	// mapのループ変数 p (pos) は使わないので省略 (keyのみ使用)
-	for key := range unknownMap {
+	for _, key := range keys {
 		if visited[key] {
 			continue
 		}
@@ -154,12 +563,10 @@ func (ts *TankSolver) createSegments() []*segment {
 		groupKeys := []int{}
 		queue := []int{key}
 		visited[key] = true
-
 		for len(queue) > 0 {
 			curr := queue[0]
 			queue = queue[1:]
 			groupKeys = append(groupKeys, curr)
-
 			for _, neighbor := range adj[curr] {
 				if !visited[neighbor] {
 					visited[neighbor] = true
@@ -167,105 +574,64 @@ func (ts *TankSolver) createSegments() []*segment {
 				}
 			}
 		}
+		sort.Ints(groupKeys)
 
-		// セグメント作成
-		seg := &segment{
-			unknowns: make([]pos, len(groupKeys)),
-			rules:    []rule{},
-		}
-
-		localIndexMap := make(map[int]int)
+		seg := &segment{unknowns: make([]pos, len(groupKeys)), rules: []rule{}}
 		for i, k := range groupKeys {
 			seg.unknowns[i] = unknownMap[k]
 			localIndexMap[k] = i
-		}
-
-		// ルール生成
-		for _, numPos := range numberedCells {
-			_, flags, neighbors := ts.getNeighbors(numPos.x, numPos.y)
-			if len(neighbors) == 0 {
-				continue
-			}
-
-			// neighborsの最初の1つがこのセグメントに含まれていれば、
-			// 全て含まれているはず（連結しているため）
-			firstKey := neighbors[0].y*ts.Board.Width + neighbors[0].x
-			if _, ok := localIndexMap[firstKey]; ok {
-				r := rule{
-					cells: make([]int, len(neighbors)),
-					mines: ts.Board.Cells[numPos.y][numPos.x].NeighborCount - flags,
-				}
-				for i, n := range neighbors {
-					nk := n.y*ts.Board.Width + n.x
-					r.cells[i] = localIndexMap[nk]
-				}
-				seg.rules = append(seg.rules, r)
-			}
+			segOf[k] = len(segments)
 		}
 		segments = append(segments, seg)
 	}
 
-	return segments
-}
-
-// --- 探索ロジック ---
-
-func (ts *TankSolver) solveSegment(seg *segment) [][]bool {
-	solutions := [][]bool{}
-	config := make([]bool, len(seg.unknowns))
-	ts.backtrack(seg, 0, config, &solutions)
-	return solutions
-}
-
-func (ts *TankSolver) backtrack(seg *segment, index int, config []bool, solutions *[][]bool) {
-	if index == len(seg.unknowns) {
-		if ts.isValid(seg, config, true) {
-			sol := make([]bool, len(config))
-			copy(sol, config)
-			*solutions = append(*solutions, sol)
+	// 3. ルール生成 (数字マスの順に、その未開封マスが属するセグメントへ)
+	for i, numPos := range numberedCells {
+		neighbors := hiddenOf[i]
+		if len(neighbors) == 0 {
+			continue
 		}
-		return
-	}
-
-	// 枝刈り
-	if !ts.isValid(seg, config, false) {
-		return
+		seg := segments[segOf[neighbors[0].y*w+neighbors[0].x]]
+		r := rule{
+			cells: make([]int, len(neighbors)),
+			mines: ts.Board.Cells[numPos.y][numPos.x].NeighborCount - flagsOf[i],
+			at:    numPos,
+		}
+		for j, n := range neighbors {
+			r.cells[j] = localIndexMap[n.y*w+n.x]
+		}
+		seg.rules = append(seg.rules, r)
 	}
-
-	// 仮定1: 地雷
-	config[index] = true
-	ts.backtrack(seg, index+1, config, solutions)
-
-	// 仮定2: 安全
-	config[index] = false
-	ts.backtrack(seg, index+1, config, solutions)
+	return segments
 }
 
-func (ts *TankSolver) isValid(seg *segment, config []bool, isFinal bool) bool {
-	for _, r := range seg.rules {
-		mines := 0
-		// unknowns（未決定数）は削除（簡易チェックのため）
-
-		for _, idx := range r.cells {
-			if config[idx] {
-				mines++
+// flatten は全セグメントを1つの変数集合にまとめ、境界のマス・ルール・内側のマスを返します
+// (セグメントごとに数えないモンテカルロ法や SAT で使う)
+func (ts *TankSolver) flatten() (frontier []pos, rules []rule, interior []pos) {
+	inFrontier := make(map[pos]bool)
+	for _, seg := range ts.createSegments() {
+		offset := len(frontier)
+		frontier = append(frontier, seg.unknowns...)
+		for _, r := range seg.rules {
+			g := rule{mines: r.mines, at: r.at, cells: make([]int, len(r.cells))}
+			for i, c := range r.cells {
+				g.cells[i] = c + offset
 			}
+			rules = append(rules, g)
 		}
-
-		if isFinal {
-			// 最終チェック: 地雷数がぴったり一致すること
-			if mines != r.mines {
-				return false
-			}
-		} else {
-			// 途中チェック: 既に地雷数がオーバーしていたらアウト
-			if mines > r.mines {
-				return false
+	}
+	for _, p := range frontier {
+		inFrontier[p] = true
+	}
+	for y := 0; y < ts.Board.Height; y++ {
+		for x := 0; x < ts.Board.Width; x++ {
+			c := ts.Board.Cells[y][x]
+			if !c.IsRevealed && !c.IsFlagged && ts.Board.IsPlayable(x, y) && !inFrontier[pos{x, y}] {
+				interior = append(interior, pos{x, y})
 			}
-			// ※「残り全てを地雷にしても足りない」ケースの枝刈りは省略（実装の複雑化回避のため）
 		}
 	}
-	return true
+	return frontier, rules, interior
 }
 
 // ヘルパー
@@ -276,7 +642,7 @@ func (ts *TankSolver) getNeighbors(cx, cy int) (totalHidden int, flags int, hidd
 				continue
 			}
 			nx, ny := cx+dx, cy+dy
-			if nx >= 0 && nx < ts.Board.Width && ny >= 0 && ny < ts.Board.Height {
+			if ts.Board.Contains(nx, ny) {
 				neighbor := ts.Board.Cells[ny][nx]
 				if neighbor.IsFlagged {
 					flags++
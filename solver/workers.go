@@ -0,0 +1,8 @@
+//go:build !js
+
+package solver
+
+import "runtime"
+
+// DefaultWorkers はタンクでセグメントを並列に数えるゴルーチン数の既定値 (CPU 数)
+var DefaultWorkers = runtime.GOMAXPROCS(0)
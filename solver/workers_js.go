@@ -0,0 +1,7 @@
+//go:build js
+
+package solver
+
+// DefaultWorkers はタンクでセグメントを並列に数えるゴルーチン数の既定値
+// WebAssembly はシングルスレッドで並列に動かないので、ゴルーチンを作らずに順に数えます
+var DefaultWorkers = 1
@@ -2,6 +2,10 @@ const go = new Go();
 WebAssembly.instantiateStreaming(fetch("main.wasm"), go.importObject).then((result) => {
     go.run(result.instance);
     console.log("WASM Loaded");
+    // 大きな盤面でも軽いように、変化したマスだけ受け取る
+    if (typeof goSetPatchMode === 'function') goSetPatchMode(true);
+    loadBotModes();
+    changeRules();
     resetGame(false);
 });
 
@@ -9,7 +13,9 @@ function getSettings() {
     const w = parseInt(document.getElementById('width').value) || 10;
     const h = parseInt(document.getElementById('height').value) || 10;
     const m = parseInt(document.getElementById('mines').value) || 10;
-    return { w, h, m };
+    const shapeEl = document.getElementById('shape');
+    const shape = shapeEl ? shapeEl.value : 'rect';
+    return { w, h, m, shape };
 }
 
 const botLoopState = {
@@ -27,8 +33,8 @@ function resetGame(isBotReset = false) {
         stopBotLoop();
     }
     if (typeof goNewGame === 'function') {
-        const { w, h, m } = getSettings();
-        const jsonStr = goNewGame(w, h, m);
+        const { w, h, m, shape } = getSettings();
+        const jsonStr = goNewGame(w, h, m, shape);
         render(jsonStr);
     }
 }
@@ -88,7 +94,7 @@ function runBotInterval() {
             
             render(jsonStr);
 
-            if (state.is_game_over || state.is_game_clear) {
+            if (state.is_game_over || state.is_game_clear || state.is_time_up) {
                 clearInterval(botLoopState.intervalId);
                 if (state.is_game_clear) botLoopState.wins++;
                 botLoopState.currentRun++;
@@ -168,6 +174,7 @@ function logReport(reportText) {
 
 function render(jsonStr) {
     if (!jsonStr || jsonStr === "{}") return;
+    hintLevel = 0; // 盤面が変わったらヒントは最初の段階から
     let gameState;
     try { gameState = JSON.parse(jsonStr); } catch(e) { return; }
     
@@ -176,13 +183,129 @@ function render(jsonStr) {
     }
     
     const board = document.getElementById('board');
-    const w = gameState.cells[0].length;
+    if (gameState.cells) {
+        buildBoard(board, gameState.cells);
+    }
+
+    const mineEl = document.getElementById('mine-count');
+    if (mineEl) mineEl.innerText = gameState.mines_remaining;
+    const scoreEl = document.getElementById('score');
+    if (scoreEl) scoreEl.innerText = gameState.score;
+    const clicksEl = document.getElementById('clicks');
+    if (clicksEl) clicksEl.innerText = gameState.bbbv ? `${gameState.clicks} (3BV ${gameState.bbbv})` : gameState.clicks;
+
+    if (!botLoopState.isRunning) {
+        if (gameState.is_game_over) updateStatus("GAME OVER");
+        else if (gameState.is_game_clear) updateStatus("CLEARED!");
+        else if (gameState.is_time_up) updateStatus("TIME UP!");
+        else if (gameState.rules === 'time') updateStatus(`Time left: ${gameState.time_left.toFixed(1)}s`);
+        else updateStatus("");
+    }
+
+    if (gameState.cells) {
+        gameState.cells.forEach((row, y) => {
+            row.forEach((c, x) => drawCell(x, y, c));
+        });
+    } else {
+        // 差分モード: 変化したマスだけ描き直す
+        (gameState.patches || []).forEach(p => drawCell(p.x, p.y, p));
+    }
+    showMove(gameState.move);
+    if (heatmapOn) drawHeatmap();
+}
+
+// --- 地雷確率のヒートマップ ---
+let heatmapOn = false;
+
+function toggleHeatmap() {
+    heatmapOn = !heatmapOn;
+    const btn = document.getElementById('heatmap-btn');
+    if (btn) btn.classList.toggle('active', heatmapOn);
+    drawHeatmap();
+}
+
+// 未開封マスの背景を地雷確率で塗り、確定マスには印を付ける (確率はマウスオーバーで表示)
+function drawHeatmap() {
+    document.querySelectorAll('.cell.heat').forEach(el => {
+        el.classList.remove('heat', 'certain-safe', 'certain-mine');
+        el.style.removeProperty('--heat');
+        el.title = '';
+    });
+    if (!heatmapOn || typeof goProbabilities !== 'function') return;
+    let pm;
+    try { pm = JSON.parse(goProbabilities()); } catch(e) { return; }
+    if (!pm.cells) return;
+    pm.cells.forEach((row, y) => row.forEach((c, x) => {
+        if (c.kind !== 'frontier' && c.kind !== 'interior' && c.kind !== 'unsolved') return;
+        const el = document.getElementById(`c-${x}-${y}`);
+        if (!el) return;
+        el.classList.add('heat');
+        el.style.setProperty('--heat', c.p.toFixed(3));
+        if (c.certain) el.classList.add(c.p >= 0.5 ? 'certain-mine' : 'certain-safe');
+        // unsolved は数えきれなかった境界のマスで、確率は残り地雷数を割り振っただけの概算
+        el.title = `${(c.p * 100).toFixed(1)}%${c.kind === 'unsolved' ? ' (rough guess)' : pm.exact ? '' : ' (estimated)'}`;
+    }));
+}
+
+// 手 (ヒント) の対象マスと根拠のマスを強調し、理由を表示する
+// 盤面が矛盾している場合 (action が unflag) は外すべき旗を強調する
+function showMove(move) {
+    document.querySelectorAll('.cell.hint-target, .cell.evidence, .cell.wrong-flag, .cell.hint-region').forEach(el => {
+        el.classList.remove('hint-target', 'evidence', 'wrong-flag', 'hint-region');
+    });
+    const expEl = document.getElementById('explanation');
+    if (!move) {
+        if (expEl) expEl.innerText = '';
+        return;
+    }
+    (move.evidence || []).forEach(p => {
+        const el = document.getElementById(`c-${p.x}-${p.y}`);
+        if (el) el.classList.add('evidence');
+    });
+    (move.flags || []).forEach(p => {
+        const el = document.getElementById(`c-${p.x}-${p.y}`);
+        if (el) el.classList.add('wrong-flag');
+    });
+    const target = document.getElementById(`c-${move.x}-${move.y}`);
+    if (target) target.classList.add('hint-target');
+    if (expEl) {
+        const action = { flag: 'Flag', unflag: 'Unflag', chord: 'Chord' }[move.action] || 'Open';
+        expEl.innerText = `${action} (${move.x},${move.y}) — ${move.strategy}: ${move.reason}`;
+    }
+}
+
+// ヒントは押すたびに 1: 範囲 -> 2: 手法 -> 3: 手そのもの と詳しくなる
+let hintLevel = 0;
+
+function showHint() {
+    if (typeof goHint !== 'function') return;
+    hintLevel = Math.min(hintLevel + 1, 3);
+    let hint;
+    try { hint = JSON.parse(goHint(hintLevel)); } catch(e) { return; }
+    if (!hint.message) return;
+
+    showMove(hint.move);
+    const r = hint.region;
+    if (r) {
+        for (let y = r.y; y < r.y + r.height; y++) {
+            for (let x = r.x; x < r.x + r.width; x++) {
+                const el = document.getElementById(`c-${x}-${y}`);
+                if (el) el.classList.add('hint-region');
+            }
+        }
+    }
+    const expEl = document.getElementById('explanation');
+    if (expEl) expEl.innerText = `Hint ${hint.level}/3: ${hint.message} (hints used: ${hint.hints_used})`;
+}
+
+function buildBoard(board, cells) {
+    const w = cells[0].length;
     board.style.width = `${w * 32}px`;
     board.style.gridTemplateColumns = `repeat(${w}, 30px)`;
-    
-    if (board.childElementCount !== gameState.cells.length * w) {
+
+    if (board.childElementCount !== cells.length * w) {
         board.innerHTML = '';
-        gameState.cells.forEach((row, y) => {
+        cells.forEach((row, y) => {
             row.forEach((_, x) => {
                 const div = document.createElement('div');
                 div.id = `c-${x}-${y}`;
@@ -193,31 +316,38 @@ function render(jsonStr) {
             });
         });
     }
+}
 
-    const mineEl = document.getElementById('mine-count');
-    if (mineEl) mineEl.innerText = gameState.mines_remaining;
-
-    if (!botLoopState.isRunning) {
-        if (gameState.is_game_over) updateStatus("GAME OVER");
-        else if (gameState.is_game_clear) updateStatus("CLEARED!");
-        else updateStatus("");
+function drawCell(x, y, c) {
+    const div = document.getElementById(`c-${x}-${y}`);
+    if (!div) return;
+    div.className = 'cell';
+    div.innerText = '';
+    if (c.state === 'void') {
+        div.classList.add('void');
+    } else if (c.state === 'opened') {
+        div.classList.add('opened');
+        if (c.is_mine) { div.classList.add('mine'); div.innerText = "💣"; }
+        else if (c.count > 0) { div.classList.add('n'+c.count); div.innerText = c.count; }
+    } else if (c.state === 'flagged') {
+        div.innerText = "🚩";
     }
+}
 
-    gameState.cells.forEach((row, y) => {
-        row.forEach((c, x) => {
-            const div = document.getElementById(`c-${x}-${y}`);
-            if(!div) return;
-            div.className = 'cell';
-            div.innerText = '';
-            if (c.state === 'opened') {
-                div.classList.add('opened');
-                if (c.is_mine) { div.classList.add('mine'); div.innerText = "💣"; }
-                else if (c.count > 0) { div.classList.add('n'+c.count); div.innerText = c.count; }
-            } else if (c.state === 'flagged') {
-                div.innerText = "🚩";
-            }
-        });
+// Go 側のパイプライン一覧からモード選択の選択肢を作る
+function loadBotModes() {
+    if (typeof goListPipelines !== 'function') return;
+    const select = document.getElementById('bot-mode');
+    const current = select.value;
+    select.innerHTML = '';
+    JSON.parse(goListPipelines()).forEach(p => {
+        const opt = document.createElement('option');
+        opt.value = p.name;
+        opt.innerText = p.description;
+        opt.title = p.config;
+        select.appendChild(opt);
     });
+    if ([...select.options].some(o => o.value === current)) select.value = current;
 }
 
 function changeBotMode() {
@@ -229,5 +359,16 @@ function changeBotMode() {
     }
 }
 
+function changeRules() {
+    const rules = document.getElementById('rules').value;
+    const seconds = parseFloat(document.getElementById('time-limit').value) || 60;
+    const firstClick = document.getElementById('first-click').value;
+    if (typeof goSetRules === 'function') {
+        const msg = goSetRules(rules, seconds, firstClick);
+        console.log(msg);
+        updateStatus(msg);
+    }
+}
+
 function openCell(x, y) { if(typeof goOpenCell === 'function') render(goOpenCell(x, y)); }
 function toggleFlag(x, y) { if(typeof goToggleFlag === 'function') render(goToggleFlag(x, y)); }
\ No newline at end of file
@@ -0,0 +1,46 @@
+package viewmodel
+
+import (
+	"encoding/json"
+
+	"minesweeper/solver"
+)
+
+// ProbCellView は確率マップの1マス分
+type ProbCellView struct {
+	Kind    string  `json:"kind"` // "revealed" / "flagged" / "frontier" / "interior" / "unsolved" / "void"
+	Mine    float64 `json:"p"`    // 地雷確率
+	Certain bool    `json:"certain,omitempty"`
+}
+
+// ProbabilityView は盤面に重ねて表示する地雷確率のヒートマップ
+type ProbabilityView struct {
+	Cells  [][]ProbCellView `json:"cells"`
+	Exact  bool             `json:"exact"` // false なら一部はモンテカルロの推定
+	Method string           `json:"method"`
+}
+
+var cellKinds = map[solver.CellKind]string{
+	solver.CellRevealed: "revealed",
+	solver.CellFlagged:  "flagged",
+	solver.CellFrontier: "frontier",
+	solver.CellInterior: "interior",
+	solver.CellVoid:     "void",
+	solver.CellUnsolved: "unsolved",
+}
+
+// NewProbabilityView は確率マップをJSONにします (nil なら空のJSONオブジェクト)
+func NewProbabilityView(pm *solver.ProbabilityMap) string {
+	if pm == nil {
+		return "{}"
+	}
+	view := ProbabilityView{Cells: make([][]ProbCellView, len(pm.Cells)), Exact: pm.Exact, Method: pm.Method}
+	for y, row := range pm.Cells {
+		view.Cells[y] = make([]ProbCellView, len(row))
+		for x, c := range row {
+			view.Cells[y][x] = ProbCellView{Kind: cellKinds[c.Kind], Mine: c.Mine, Certain: c.Certain}
+		}
+	}
+	bytes, _ := json.Marshal(view)
+	return string(bytes)
+}
@@ -0,0 +1,82 @@
+package viewmodel
+
+import "minesweeper/solver"
+
+// MoveView は Bot の手 (またはヒント) とその理由
+type MoveView struct {
+	X           int     `json:"x"`
+	Y           int     `json:"y"`
+	Action      string  `json:"action"` // "open" / "flag" / "unflag" / "chord"
+	Strategy    string  `json:"strategy"`
+	Confidence  float64 `json:"confidence"`
+	Reason      string  `json:"reason"`
+	Evidence    []Point `json:"evidence,omitempty"`    // 根拠になったマス
+	Approximate bool    `json:"approximate,omitempty"` // 時間切れで打ち切った近似の手
+	Flags       []Point `json:"flags,omitempty"`       // 盤面が矛盾している場合に外すべき旗の組 (action が "unflag")
+}
+
+// NewMoveView はソルバーの手を表示用に変換します (nil なら nil)
+func NewMoveView(m *solver.Move) *MoveView {
+	if m == nil {
+		return nil
+	}
+	v := &MoveView{
+		X: m.X, Y: m.Y,
+		Action:      "open",
+		Strategy:    m.Strategy.String(),
+		Confidence:  m.Confidence,
+		Reason:      m.Reason,
+		Approximate: m.Approximate,
+	}
+	switch m.Type {
+	case solver.MoveFlag:
+		v.Action = "flag"
+	case solver.MoveUnflag:
+		v.Action = "unflag"
+		v.Flags = []Point{{X: m.X, Y: m.Y}}
+	case solver.MoveChord:
+		v.Action = "chord"
+	}
+	for _, p := range m.Evidence {
+		v.Evidence = append(v.Evidence, Point{X: p.X, Y: p.Y})
+	}
+	return v
+}
+
+// RectView は盤面上の長方形の範囲
+type RectView struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// HintView は人間向けのヒント (段階が低いほど答えを明かさない)
+type HintView struct {
+	Level     int       `json:"level"` // 1: 範囲, 2: 範囲と手法, 3: 手そのもの
+	Guess     bool      `json:"guess"` // 確定手が無く推測するしかない
+	Region    *RectView `json:"region,omitempty"`
+	Technique string    `json:"technique,omitempty"`
+	Move      *MoveView `json:"move,omitempty"`
+	Message   string    `json:"message"`
+	HintsUsed int       `json:"hints_used"` // このゲームで使ったヒントの数
+}
+
+// NewHintView はソルバーのヒントを表示用に変換します (nil なら nil)
+func NewHintView(h *solver.Hint, used int) *HintView {
+	if h == nil {
+		return nil
+	}
+	v := &HintView{
+		Level:     int(h.Level),
+		Guess:     h.Guess,
+		Technique: h.Technique,
+		Move:      NewMoveView(h.Move),
+		Message:   h.Message,
+		HintsUsed: used,
+	}
+	if r := h.Region; r != nil {
+		v.Region = &RectView{X: r.X, Y: r.Y, Width: r.Width, Height: r.Height}
+	}
+	return v
+}
@@ -12,21 +12,101 @@ type CellView struct {
 	IsMine bool   `json:"is_mine"`
 }
 
+// CellPatch は差分で送るマス1つ分
+type CellPatch struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	CellView
+}
+
+// Point は盤面上の座標
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// GameView は盤面全体 (Cells) か差分 (Patches) のどちらか一方を持ちます
+// 差分JSONで変化が無い場合はどちらも省略されます
 type GameView struct {
-	Cells          [][]CellView `json:"cells"`
+	Cells          [][]CellView `json:"cells,omitempty"`
+	Patches        []CellPatch  `json:"patches,omitempty"`
 	MinesRemaining int          `json:"mines_remaining"`
 	IsGameOver     bool         `json:"is_game_over"`
 	IsGameClear    bool         `json:"is_game_clear"`
 	Report         string       `json:"report"`
+
+	// ルール関連
+	Rules    string  `json:"rules"`
+	Score    int     `json:"score"`
+	TimeLeft float64 `json:"time_left"` // タイムアタックの残り秒数
+	IsTimeUp bool    `json:"is_time_up"`
+
+	// クリック効率
+	Clicks int `json:"clicks"`
+	BBBV   int `json:"bbbv,omitempty"` // 終局後だけ (途中で見せると地雷の配置の手がかりになる)
+
+	Move *MoveView `json:"move,omitempty"` // 直前の Bot の手、またはヒント
 }
 
 // NewGameView は安全にJSONを返します
 func NewGameView(b *game.Board, report string) string {
+	return NewGameViewWithMove(b, report, nil)
+}
+
+// NewGameViewWithMove は NewGameView に手とその理由を加えたJSONを返します
+func NewGameViewWithMove(b *game.Board, report string, move *MoveView) string {
 	// 【修正点】nilの場合は空のJSONオブジェクトを返す
 	if b == nil {
 		return "{}"
 	}
 
+	view := buildGameView(b, report)
+	view.Move = move
+	bytes, _ := json.Marshal(view)
+	return string(bytes)
+}
+
+// NewGamePatch は prev から b への変化したマスだけを含むJSONを返します
+// prev が nil、またはサイズが違う場合は NewGameView と同じ全体JSONを返します
+func NewGamePatch(prev, b *game.Board, report string) string {
+	return NewGamePatchWithMove(prev, b, report, nil)
+}
+
+// NewGamePatchWithMove は NewGamePatch に手とその理由を加えたJSONを返します
+func NewGamePatchWithMove(prev, b *game.Board, report string, move *MoveView) string {
+	if b == nil {
+		return "{}"
+	}
+	changes, ok := game.Diff(prev, b)
+	if !ok {
+		return NewGameViewWithMove(b, report, move)
+	}
+
+	view := buildGameView(b, report)
+	view.Move = move
+	added := make(map[int]bool, len(changes))
+	for _, ch := range changes {
+		added[ch.Y*b.Width+ch.X] = true
+		view.Patches = append(view.Patches, CellPatch{X: ch.X, Y: ch.Y, CellView: view.Cells[ch.Y][ch.X]})
+	}
+	// ゲームオーバー・クリア時は地雷の表示が一斉に変わるので、地雷マスも送る
+	if view.IsGameOver || view.IsGameClear {
+		for y := 0; y < b.Height; y++ {
+			for x := 0; x < b.Width; x++ {
+				if b.Cells[y][x].IsMine && !added[y*b.Width+x] {
+					view.Patches = append(view.Patches, CellPatch{X: x, Y: y, CellView: view.Cells[y][x]})
+				}
+			}
+		}
+	}
+	view.Cells = nil
+
+	bytes, _ := json.Marshal(view)
+	return string(bytes)
+}
+
+// buildGameView は盤面から表示用の構造体を作ります
+func buildGameView(b *game.Board, report string) GameView {
 	h := b.Height
 	w := b.Width
 
@@ -41,6 +121,13 @@ func NewGameView(b *game.Board, report string) string {
 			c := b.Cells[y][x]
 			v := CellView{}
 
+			// 盤面の形の外側は「存在しないマス」
+			if !b.IsPlayable(x, y) {
+				v.State = "void"
+				grid[y][x] = v
+				continue
+			}
+
 			if c.IsRevealed {
 				v.State = "opened"
 				v.IsMine = c.IsMine
@@ -78,8 +165,14 @@ func NewGameView(b *game.Board, report string) string {
 		IsGameOver:     isGameOver,
 		IsGameClear:    isClear,
 		Report:         report,
+		Rules:          b.Rules.Win.String(),
+		Score:          b.Score,
+		TimeLeft:       b.TimeLeft().Seconds(),
+		IsTimeUp:       b.IsTimeUp(),
+		Clicks:         b.Clicks,
 	}
-
-	bytes, _ := json.Marshal(view)
-	return string(bytes)
+	if isGameOver || isClear {
+		view.BBBV = b.BBBV()
+	}
+	return view
 }